@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// exitInterrupted is the exit code of runs stopped by SIGINT.
+const exitInterrupted = 130
+
+// interruptible returns the context of an evaluation cancelled by the first
+// SIGINT or after the timeout if it is positive. Further signals are handled
+// as usual, so a second Ctrl-C kills a run that does not stop. The returned
+// function releases the context and reports whether SIGINT cancelled it.
+func interruptible(timeout time.Duration) (context.Context, func() bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	if timeout > 0 {
+		var cancelTimeout context.CancelFunc
+
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		cancelCtx := cancel
+		cancel = func() {
+			cancelTimeout()
+			cancelCtx()
+		}
+	}
+
+	var (
+		sig         = make(chan os.Signal, 1)
+		stopped     = make(chan struct{})
+		interrupted = make(chan bool, 1)
+	)
+
+	signal.Notify(sig, os.Interrupt)
+
+	go func() {
+		select {
+		case <-sig:
+			signal.Stop(sig)
+			cancel()
+			interrupted <- true
+		case <-stopped:
+			interrupted <- false
+		}
+	}()
+
+	return ctx, func() bool {
+		signal.Stop(sig)
+		close(stopped)
+		cancel()
+
+		return <-interrupted
+	}
+}
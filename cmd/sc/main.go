@@ -1,19 +1,188 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
 
 	"github.com/runningmaster/sc/internal/calc"
+	"github.com/runningmaster/sc/internal/parser"
 )
 
 func main() {
-	v, err := calc.Execute(strings.Join(os.Args[1:], " "))
+	var (
+		stream  = flag.Bool("stream", false, "read sorted files lazily and print the result as it is computed")
+		format  = flag.String("output-format", "lines", "output format: "+strings.Join(formats, ", ")+"; binary output is kept in memory until the result is complete")
+		history = flag.String("history", historyFile(), "history file of the interactive shell")
+		script  = flag.String("f", "", "run the statements of the script `file`")
+		explain = flag.Bool("explain", false, "print the plan of the evaluation instead of the result")
+		workers = flag.Int("workers", runtime.GOMAXPROCS(0), "maximum number of operands evaluated concurrently")
+		timeout = flag.Duration("timeout", 0, "stop evaluations running longer than the `duration`")
+		strict  = flag.Bool("strict", false, "fail on files not sorted in ascending order instead of sorting them")
+		limit   byteSize
+	)
+
+	flag.Var(&limit, "memory-limit", "spill intermediate results beyond the `size` like 512M to temporary files")
+	flag.Parse()
+
+	w, err := newWriter(*format, os.Stdout)
+	if err != nil {
+		fatal(err)
+	}
+
+	files := calc.FileResolver{Strict: *strict, Warn: func(err error) {
+		log.Printf("warning: %v, sorting the file", err)
+	}}
+
+	var (
+		opts = []calc.Option{
+			calc.WithResolver(files), calc.WithWorkers(*workers), calc.WithMemoryLimit(int64(limit)),
+		}
+		out = func() (writer, error) { return newWriter(*format, os.Stdout) }
+	)
+
+	if *explain {
+		w = discard{}
+		out = func() (writer, error) { return discard{}, nil }
+		opts = append(opts, calc.WithExplain(os.Stdout))
+	}
+
+	if flag.NArg() == 0 && *script == "" {
+		if err = repl(*history, *timeout, files, out, opts...); err != nil {
+			fatal(err)
+		}
+
+		return
+	}
+
+	ctx, stop := interruptible(*timeout)
+
+	if *script != "" {
+		err = runScript(ctx, *script, out, opts...)
+	} else {
+		err = execute(ctx, strings.Join(flag.Args(), " "), *stream, w, opts...)
+	}
+
+	if stop() && err != nil {
+		printError(err)
+		os.Exit(exitInterrupted)
+	}
+
+	if err != nil {
+		fatal(err)
+	}
+}
+
+// historyFile returns the default history file in the home directory.
+func historyFile() string {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		log.Fatal(err)
+		return ""
+	}
+
+	return filepath.Join(home, ".sc_history")
+}
+
+// execute evaluates the expression and writes the result.
+func execute(ctx context.Context, expr string, stream bool, w writer, opts ...calc.Option) error {
+	if stream {
+		// values passed on before a failure are written out.
+		err := calc.ExecuteStreamContext(ctx, expr, w.Write, opts...)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+
+		return err
+	}
+
+	v, err := calc.ExecuteContext(ctx, expr, opts...)
+	if err != nil {
+		return err
+	}
+
+	for i := range v {
+		if err = w.Write(v[i]); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+// runScript runs the script file writing the results of print statements
+// one after another with writers made by out.
+func runScript(ctx context.Context, name string, out func() (writer, error), opts ...calc.Option) error {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	return calc.ExecuteScriptContext(ctx, string(b), func(v []int64) error {
+		w, err := out()
+		if err != nil {
+			return err
+		}
+
+		for i := range v {
+			if err = w.Write(v[i]); err != nil {
+				return err
+			}
+		}
+
+		return w.Close()
+	}, opts...)
+}
+
+// byteSize is a flag of a number of bytes with an optional suffix K, M or G.
+type byteSize int64
+
+func (b *byteSize) String() string {
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(s string) error {
+	var (
+		v     = strings.TrimSuffix(strings.ToUpper(s), "B")
+		shift uint
+	)
+
+	if i := strings.LastIndexAny(v, "KMG"); i >= 0 && i == len(v)-1 {
+		shift = 10 * uint(1+strings.IndexByte("KMG", v[i]))
+		v = v[:i]
+	}
+
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64>>shift {
+		return fmt.Errorf("invalid size %q", s)
+	}
+
+	*b = byteSize(n << shift)
+
+	return nil
+}
+
+// fatal prints the error and exits.
+func fatal(err error) {
+	printError(err)
+	os.Exit(1)
+}
+
+// printError prints the error. Syntax errors are printed
+// with the expression and a caret under the offending token.
+func printError(err error) {
+	var se *parser.SyntaxError
+	if errors.As(err, &se) {
+		fmt.Fprintln(os.Stderr, se.Context())
 	}
 
-	fmt.Println(v)
+	log.Print(err)
 }
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/runningmaster/sc/internal/setfile"
+)
+
+// formats lists the output formats in the order of the help.
+var formats = []string{"lines", "json", "csv", "ranges", "count", "int64le", "binary"} //nolint: gochecknoglobals
+
+// writer writes the values of a result in ascending order.
+type writer interface {
+	Write(v int64) error
+	// Close completes the output and flushes it.
+	Close() error
+}
+
+// newWriter returns a buffered writer of the format.
+func newWriter(format string, w io.Writer) (writer, error) {
+	b := bufio.NewWriterSize(w, 64<<10)
+
+	switch format {
+	case "lines":
+		return &linesWriter{w: b}, nil
+	case "json":
+		return &listWriter{w: b, open: "[", close: "]"}, nil
+	case "csv":
+		return &listWriter{w: b}, nil
+	case "ranges":
+		return &rangesWriter{w: b}, nil
+	case "count":
+		return &countWriter{w: b}, nil
+	case "int64le":
+		return &int64leWriter{w: b}, nil
+	case "binary":
+		return &binaryWriter{w: setfile.NewBinaryWriter(b), b: b}, nil
+	}
+
+	return nil, fmt.Errorf("unknown output format %q, want one of %s", format, strings.Join(formats, ", "))
+}
+
+// linesWriter writes decimal values one in a line.
+type linesWriter struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+func (l *linesWriter) Write(v int64) error {
+	l.buf = strconv.AppendInt(l.buf[:0], v, 10)
+	l.buf = append(l.buf, '\n')
+	_, err := l.w.Write(l.buf)
+
+	return err
+}
+
+func (l *linesWriter) Close() error {
+	return l.w.Flush()
+}
+
+// listWriter writes decimal values separated by commas in a single line
+// enclosed by open and close.
+type listWriter struct {
+	w     *bufio.Writer
+	open  string
+	close string
+	buf   []byte
+	n     int
+}
+
+func (l *listWriter) Write(v int64) error {
+	if l.n == 0 {
+		l.buf = append(l.buf[:0], l.open...)
+	} else {
+		l.buf = append(l.buf[:0], ',')
+	}
+
+	l.buf = strconv.AppendInt(l.buf, v, 10)
+	l.n++
+	_, err := l.w.Write(l.buf)
+
+	return err
+}
+
+func (l *listWriter) Close() error {
+	if l.n == 0 {
+		_, _ = l.w.WriteString(l.open)
+	}
+
+	_, _ = l.w.WriteString(l.close + "\n")
+
+	return l.w.Flush()
+}
+
+// rangesWriter writes runs of consecutive values compressed like the range
+// literals of expressions, -3..-1,9,12..20.
+type rangesWriter struct {
+	w      *bufio.Writer
+	lo, hi int64
+	n      int
+	buf    []byte
+}
+
+func (r *rangesWriter) Write(v int64) error {
+	if r.n > 0 && v == r.hi+1 {
+		r.hi = v
+		return nil
+	}
+
+	var err error
+	if r.n > 0 {
+		err = r.flush(",")
+	}
+
+	r.lo, r.hi = v, v
+	r.n++
+
+	return err
+}
+
+func (r *rangesWriter) flush(end string) error {
+	r.buf = strconv.AppendInt(r.buf[:0], r.lo, 10)
+	if r.hi > r.lo {
+		r.buf = append(r.buf, ".."...)
+		r.buf = strconv.AppendInt(r.buf, r.hi, 10)
+	}
+
+	r.buf = append(r.buf, end...)
+	_, err := r.w.Write(r.buf)
+
+	return err
+}
+
+func (r *rangesWriter) Close() error {
+	if r.n == 0 {
+		_, _ = r.w.WriteString("\n")
+	} else if err := r.flush("\n"); err != nil {
+		return err
+	}
+
+	return r.w.Flush()
+}
+
+// countWriter writes the number of values.
+type countWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (c *countWriter) Write(int64) error {
+	c.n++
+	return nil
+}
+
+func (c *countWriter) Close() error {
+	_, _ = c.w.WriteString(strconv.FormatInt(c.n, 10) + "\n")
+	return c.w.Flush()
+}
+
+// int64leWriter writes values as little-endian 8-byte integers.
+type int64leWriter struct {
+	w   *bufio.Writer
+	buf [8]byte
+}
+
+func (b *int64leWriter) Write(v int64) error {
+	binary.LittleEndian.PutUint64(b.buf[:], uint64(v))
+	_, err := b.w.Write(b.buf[:])
+
+	return err
+}
+
+func (b *int64leWriter) Close() error {
+	return b.w.Flush()
+}
+
+// binaryWriter writes a binary set file when it is closed.
+type binaryWriter struct {
+	w *setfile.BinaryWriter
+	b *bufio.Writer
+}
+
+func (b *binaryWriter) Write(v int64) error {
+	return b.w.Write(v)
+}
+
+func (b *binaryWriter) Close() error {
+	if err := b.w.Flush(); err != nil {
+		return err
+	}
+
+	return b.b.Flush()
+}
+
+// discard drops the values.
+type discard struct{}
+
+func (discard) Write(int64) error {
+	return nil
+}
+
+func (discard) Close() error {
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRangesWriter(t *testing.T) {
+	for i, tt := range []struct {
+		in  []int64
+		out string
+	}{
+		{nil, "\n"},
+		{[]int64{7}, "7\n"},
+		{[]int64{1, 2, 3, 4, 5, 9, 12, 13}, "1..5,9,12..13\n"},
+		{[]int64{-5, -4, -3, -1, 0, 1, 7}, "-5..-3,-1..1,7\n"},
+		{[]int64{-9223372036854775808, -9223372036854775807}, "-9223372036854775808..-9223372036854775807\n"},
+	} {
+		var b bytes.Buffer
+
+		w, err := newWriter("ranges", &b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, v := range tt.in {
+			if err = w.Write(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err = w.Close(); err != nil || b.String() != tt.out {
+			t.Errorf("pos %v: got %q (%v), want %q", i, b.String(), err, tt.out)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// maxHistory limits the number of lines kept in the history.
+const maxHistory = 1000
+
+// errInterrupted is returned by readLine when the user presses Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads lines with editing and history if the input is
+// a terminal, otherwise it reads plain lines.
+type lineReader struct {
+	in      *bufio.Reader
+	out     io.Writer
+	fd      int
+	term    bool
+	history []string
+	file    string // history file, empty if the history is not persisted
+}
+
+// newLineReader returns a lineReader of stdin loading the history from file.
+func newLineReader(file string) *lineReader {
+	l := &lineReader{
+		in:   bufio.NewReader(os.Stdin),
+		out:  os.Stdout,
+		fd:   int(os.Stdin.Fd()),
+		file: file,
+	}
+
+	l.term = isTerminal(l.fd) && isTerminal(int(os.Stdout.Fd()))
+
+	if b, err := ioutil.ReadFile(file); err == nil && file != "" {
+		l.history = strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+		if len(l.history) > maxHistory {
+			l.history = l.history[len(l.history)-maxHistory:]
+		}
+	}
+
+	return l
+}
+
+// addHistory appends the entry to the history and to the history file.
+// Lines of the entry are joined, they are equivalent in expressions.
+// Entries read from input other than a terminal, like piped scripts, are
+// not saved.
+func (l *lineReader) addHistory(entry string) {
+	entry = strings.Join(strings.Fields(entry), " ")
+	if !l.term || entry == "" || len(l.history) > 0 && l.history[len(l.history)-1] == entry {
+		return
+	}
+
+	l.history = append(l.history, entry)
+
+	if l.file == "" {
+		return
+	}
+
+	f, err := os.OpenFile(l.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+
+	_, _ = f.WriteString(entry + "\n")
+	_ = f.Close()
+}
+
+// readLine reads a line printing the prompt. At the end of input
+// readLine returns io.EOF.
+func (l *lineReader) readLine(prompt string) (string, error) {
+	if !l.term {
+		s, err := l.in.ReadString('\n')
+		if err == io.EOF && s != "" {
+			err = nil
+		}
+
+		return strings.TrimRight(s, "\r\n"), err
+	}
+
+	state, err := makeRaw(l.fd)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = restore(l.fd, state) }()
+
+	return l.edit(prompt)
+}
+
+// Control keys of the line editor.
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = '\r'
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// edit reads a line in raw mode.
+func (l *lineReader) edit(prompt string) (string, error) {
+	var (
+		line  []rune
+		pos   int
+		hist  = len(l.history)
+		saved []rune
+	)
+
+	l.refresh(prompt, line, pos)
+
+	for {
+		r, _, err := l.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, '\n':
+			fmt.Fprint(l.out, "\r\n")
+			return string(line), nil
+		case keyCtrlC:
+			fmt.Fprint(l.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(line) == 0 {
+				fmt.Fprint(l.out, "\r\n")
+				return "", io.EOF
+			}
+
+			if pos < len(line) {
+				line = append(line[:pos], line[pos+1:]...)
+			}
+		case keyCtrlA:
+			pos = 0
+		case keyCtrlE:
+			pos = len(line)
+		case keyCtrlB:
+			if pos > 0 {
+				pos--
+			}
+		case keyCtrlF:
+			if pos < len(line) {
+				pos++
+			}
+		case keyCtrlK:
+			line = line[:pos]
+		case keyCtrlU:
+			line = append(line[:0], line[pos:]...)
+			pos = 0
+		case keyCtrlW:
+			i := pos
+			for i > 0 && unicode.IsSpace(line[i-1]) {
+				i--
+			}
+
+			for i > 0 && !unicode.IsSpace(line[i-1]) {
+				i--
+			}
+
+			line = append(line[:i], line[pos:]...)
+			pos = i
+		case keyCtrlL:
+			fmt.Fprint(l.out, "\x1b[H\x1b[2J")
+		case keyBackspace, keyCtrlH:
+			if pos > 0 {
+				line = append(line[:pos-1], line[pos:]...)
+				pos--
+			}
+		case keyCtrlP, keyCtrlN:
+			line, pos, hist, saved = l.recall(r == keyCtrlP, line, hist, saved)
+		case keyEscape:
+			line, pos, hist, saved = l.escape(line, pos, hist, saved)
+		default:
+			if unicode.IsPrint(r) {
+				line = append(line[:pos], append([]rune{r}, line[pos:]...)...)
+				pos++
+			}
+		}
+
+		l.refresh(prompt, line, pos)
+	}
+}
+
+// escape handles the escape sequences of arrow, home, end and delete keys.
+func (l *lineReader) escape(line []rune, pos, hist int, saved []rune) ([]rune, int, int, []rune) {
+	r, _, err := l.in.ReadRune()
+	if err != nil || r != '[' && r != 'O' {
+		return line, pos, hist, saved
+	}
+
+	var arg []rune
+
+	for {
+		if r, _, err = l.in.ReadRune(); err != nil {
+			return line, pos, hist, saved
+		}
+
+		if r < '0' || r > '9' {
+			break
+		}
+
+		arg = append(arg, r)
+	}
+
+	switch {
+	case r == 'A':
+		line, pos, hist, saved = l.recall(true, line, hist, saved)
+	case r == 'B':
+		line, pos, hist, saved = l.recall(false, line, hist, saved)
+	case r == 'C' && pos < len(line):
+		pos++
+	case r == 'D' && pos > 0:
+		pos--
+	case r == 'H', r == '~' && (string(arg) == "1" || string(arg) == "7"):
+		pos = 0
+	case r == 'F', r == '~' && (string(arg) == "4" || string(arg) == "8"):
+		pos = len(line)
+	case r == '~' && string(arg) == "3" && pos < len(line):
+		line = append(line[:pos], line[pos+1:]...)
+	}
+
+	return line, pos, hist, saved
+}
+
+// recall replaces the line by the previous or the next line of the history.
+// The edited line is saved to get back to it after the newest history line.
+func (l *lineReader) recall(prev bool, line []rune, hist int, saved []rune) ([]rune, int, int, []rune) {
+	switch {
+	case prev && hist > 0:
+		if hist == len(l.history) {
+			saved = append(saved[:0], line...)
+		}
+
+		hist--
+		line = []rune(l.history[hist])
+	case !prev && hist < len(l.history)-1:
+		hist++
+		line = []rune(l.history[hist])
+	case !prev && hist == len(l.history)-1:
+		hist++
+		line = append([]rune(nil), saved...)
+	}
+
+	return line, len(line), hist, saved
+}
+
+// refresh redraws the line and puts the cursor at pos.
+func (l *lineReader) refresh(prompt string, line []rune, pos int) {
+	s := "\r" + prompt + string(line) + "\x1b[K"
+	if n := len(line) - pos; n > 0 {
+		s += fmt.Sprintf("\x1b[%dD", n)
+	}
+
+	fmt.Fprint(l.out, s)
+}
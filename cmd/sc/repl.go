@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/runningmaster/sc/internal/calc"
+)
+
+const replHelp = `Enter an expression like [SUM a.txt [INT b.txt c.txt]] to evaluate it.
+Expressions may span several lines until all brackets are closed.
+
+  name = expr   evaluate expr and keep the result as the set name
+  :explain expr evaluate expr printing its plan instead of the result
+  :time         toggle printing of the evaluation time
+  :load dir     keep the files of dir as sets named by the file names
+  :vars         list the sets kept in the session
+  :help         print this help
+  :quit         leave the shell (or Ctrl-D)
+`
+
+var assignment = regexp.MustCompile(`(?s)^\s*([\pL_][\pL\pN_.-]*)\s*=(.*)$`) //nolint: gochecknoglobals
+
+// session holds the state of an interactive shell.
+type session struct {
+	vars   calc.MapResolver
+	writer func() (writer, error) // makes the writers of results
+	out    io.Writer
+	time   bool
+	quit   bool
+
+	timeout time.Duration // limit of evaluations, 0 for none
+	files   calc.FileResolver
+	opts    []calc.Option // options of evaluations
+}
+
+// repl runs an interactive shell until the end of input or :quit.
+// Results are written with writers made by out, expressions are evaluated
+// with opts. Ctrl-C stops the evaluation in progress, not the shell.
+func repl(history string, timeout time.Duration, files calc.FileResolver, out func() (writer, error), opts ...calc.Option) error {
+	var (
+		lr = newLineReader(history)
+		s  = &session{
+			vars: calc.MapResolver{}, writer: out, out: os.Stdout, timeout: timeout, files: files, opts: opts,
+		}
+	)
+
+	if lr.term {
+		fmt.Fprintln(s.out, "sc interactive shell, enter :help for help")
+	}
+
+	for !s.quit {
+		entry, err := readEntry(lr)
+		if errors.Is(err, errInterrupted) {
+			continue
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		lr.addHistory(entry)
+
+		if err = s.run(entry); err != nil {
+			printError(err)
+		}
+	}
+
+	return nil
+}
+
+// readEntry reads lines until all brackets of the entry are closed.
+func readEntry(lr *lineReader) (string, error) {
+	prompt := "sc> "
+	if !lr.term {
+		prompt = ""
+	}
+
+	var entry string
+
+	for {
+		line, err := lr.readLine(prompt)
+		if err == io.EOF && entry != "" {
+			return entry, nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if entry != "" {
+			entry += "\n"
+		}
+
+		entry += line
+
+		if !unclosed(entry) {
+			return entry, nil
+		}
+
+		if lr.term {
+			prompt = "... "
+		}
+	}
+}
+
+// unclosed reports whether s has unclosed brackets or braces.
+func unclosed(s string) bool {
+	var (
+		depth int
+		quote bool
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote && c == '\\':
+			i++
+		case c == '"':
+			quote = !quote
+		case quote:
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+
+	return depth > 0
+}
+
+// run runs a command, an assignment or an expression of the shell.
+func (s *session) run(entry string) error {
+	if s.time {
+		defer func(start time.Time) {
+			fmt.Fprintf(os.Stderr, "time: %v\n", time.Since(start))
+		}(time.Now())
+	}
+
+	entry = strings.TrimSpace(entry)
+
+	if strings.HasPrefix(entry, ":") {
+		cmd, arg := entry, ""
+		if i := strings.IndexFunc(entry, isSpace); i > 0 {
+			cmd, arg = entry[:i], strings.TrimSpace(entry[i:])
+		}
+
+		return s.command(cmd, arg)
+	}
+
+	if m := assignment.FindStringSubmatch(entry); m != nil {
+		v, err := s.eval(m[2])
+		if err != nil {
+			return err
+		}
+
+		s.vars[m[1]] = v
+		fmt.Fprintf(s.out, "%s: %d elements\n", m[1], len(v))
+
+		return nil
+	}
+
+	v, err := s.eval(entry)
+	if err != nil {
+		return err
+	}
+
+	w, err := s.writer()
+	if err != nil {
+		return err
+	}
+
+	for i := range v {
+		if err = w.Write(v[i]); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+func (s *session) command(cmd, arg string) error {
+	switch cmd {
+	case ":help", ":h":
+		fmt.Fprint(s.out, replHelp)
+	case ":quit", ":q", ":exit":
+		s.quit = true
+	case ":time":
+		s.time = !s.time
+		if s.time {
+			fmt.Fprintln(s.out, "timing is on")
+		} else {
+			fmt.Fprintln(s.out, "timing is off")
+		}
+	case ":vars":
+		names := make([]string, 0, len(s.vars))
+		for k := range s.vars {
+			names = append(names, k)
+		}
+
+		sort.Strings(names)
+
+		for _, k := range names {
+			fmt.Fprintf(s.out, "%s: %d elements\n", k, len(s.vars[k]))
+		}
+	case ":explain":
+		_, err := s.eval(arg, calc.WithExplain(s.out))
+		return err
+	case ":load":
+		return s.load(arg)
+	default:
+		return fmt.Errorf("unknown command %s, enter :help for help", cmd)
+	}
+
+	return nil
+}
+
+// eval evaluates the expression with the options of the session and opts
+// resolving the sets of the session before files.
+func (s *session) eval(expr string, opts ...calc.Option) ([]int64, error) {
+	opts = append(append(s.opts[:len(s.opts):len(s.opts)], opts...), calc.WithResolver(calc.MultiResolver{s.vars, s.files}))
+
+	ctx, stop := interruptible(s.timeout)
+	defer stop()
+
+	return calc.ExecuteContext(ctx, expr, opts...)
+}
+
+// load reads the files of the directory into the sets of the session.
+// Unreadable files are reported and skipped.
+func (s *session) load(dir string) error {
+	if dir == "" {
+		return errors.New("usage: :load dir")
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var n int
+
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+
+		v, err := s.files.Resolve(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			printError(err)
+			continue
+		}
+
+		s.vars[fi.Name()] = v
+		n++
+	}
+
+	fmt.Fprintf(s.out, "loaded %d sets from %s\n", n, dir)
+
+	return nil
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
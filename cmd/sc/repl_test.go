@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/runningmaster/sc/internal/calc"
+	"github.com/runningmaster/sc/internal/testutil"
+)
+
+func TestSessionOptions(t *testing.T) {
+	var (
+		plan, res bytes.Buffer
+		s         = &session{
+			vars:   calc.MapResolver{"a": {1, 2, 3}},
+			writer: func() (writer, error) { return newWriter("lines", &res) },
+			out:    ioutil.Discard,
+			opts:   []calc.Option{calc.WithWorkers(1), calc.WithExplain(&plan)},
+		}
+	)
+
+	if err := s.run("[SUM a 5..6]"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(plan.String(), "SUM") {
+		t.Errorf("plan: got %q, want the plan of SUM", plan.String())
+	}
+
+	if got, want := res.String(), "1\n2\n3\n5\n6\n"; got != want {
+		t.Errorf("result: got %q, want %q", got, want)
+	}
+}
+
+func TestAddHistory(t *testing.T) {
+	dir, cleanup := testutil.TempDir(t)
+	defer cleanup()
+
+	for _, term := range []bool{false, true} {
+		file := filepath.Join(dir, "history")
+		_ = os.Remove(file)
+
+		l := &lineReader{term: term, file: file}
+		l.addHistory("[SUM a\n b]")
+
+		b, err := ioutil.ReadFile(file)
+		if term && (err != nil || string(b) != "[SUM a b]\n") {
+			t.Errorf("term: got %q, %v, want the entry saved", b, err)
+		}
+
+		if !term && !os.IsNotExist(err) {
+			t.Errorf("not term: got %q, %v, want no history file", b, err)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package main
+
+import (
+	"errors"
+)
+
+// termState is the state of a terminal to restore.
+type termState struct{}
+
+// isTerminal reports whether fd refers to a terminal.
+// Line editing is not supported on this platform.
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (*termState, error) {
+	return nil, errors.New("line editing is not supported on this platform")
+}
+
+func restore(fd int, s *termState) error {
+	return nil
+}
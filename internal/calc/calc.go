@@ -1,73 +1,632 @@
 package calc
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/runningmaster/sc/internal/parser"
 	"github.com/runningmaster/sc/internal/sets"
-	"github.com/runningmaster/sc/internal/sortutil"
 )
 
-func Execute(cmd string) ([]int64, error) {
+// Option configures Execute.
+type Option func(*config)
+
+type config struct {
+	resolver Resolver
+	explain  io.Writer
+	workers  int
+	limit    int64
+}
+
+// WithResolver makes Execute resolve operands with r.
+// By default operands are resolved with FileResolver.
+func WithResolver(r Resolver) Option {
+	return func(c *config) {
+		c.resolver = r
+	}
+}
+
+// WithWorkers limits the number of operands evaluated concurrently by
+// Execute and ExecuteScript to n. By default n is runtime.GOMAXPROCS(0),
+// n of 1 evaluates operands one by one. Resolvers must be safe for
+// concurrent use if n is greater than 1.
+func WithWorkers(n int) Option {
+	return func(c *config) {
+		c.workers = n
+	}
+}
+
+func newConfig(opts []Option) config {
+	c := config{resolver: FileResolver{}, workers: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	return c
+}
+
+// Execute evaluates the expression cmd. Equal subexpressions and operands
+// repeated in cmd are evaluated once, operands of an expression are evaluated
+// concurrently as limited by WithWorkers. The first failing operand cancels
+// the evaluation of the others.
+func Execute(cmd string, opts ...Option) ([]int64, error) {
+	return ExecuteContext(context.Background(), cmd, opts...)
+}
+
+// ExecuteContext is like Execute but stops the evaluation when ctx is done
+// returning *InterruptedError.
+func ExecuteContext(ctx context.Context, cmd string, opts ...Option) ([]int64, error) {
+	c := newConfig(opts)
+
 	ast, err := parser.Parse(cmd)
 	if err != nil {
 		return nil, err
 	}
 
-	var stack []*parser.Node
+	p, err := newPlanner(c.resolver).build(ast, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	plans, err := optimize(c.resolver, p)
+	if err != nil {
+		return nil, err
+	}
+
+	e := newEvaluator(c, plans)
+	defer e.cleanup()
+
+	s, err := e.eval(ctx, plans[0])
+	if err != nil {
+		return nil, e.interrupted(ctx, err)
+	}
+
+	v, err := e.values(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.explain == nil {
+		return v, nil
+	}
+
+	return v, e.explain(c.explain, []*parser.Node{ast}, nil, plans, nil)
+}
+
+// evaluator evaluates plans. Values of nodes used several times are kept
+// until their last use. Operands are evaluated concurrently by at most
+// workers goroutines. Values not fitting the memory limit are spilled to
+// temporary files of dir.
+type evaluator struct {
+	r       Resolver
+	sem     chan struct{} // slots of goroutines besides the calling one
+	mu      sync.Mutex
+	limit   int64 // limit of bytes of values kept in memory, 0 for none
+	held    int64 // bytes of values kept in memory
+	dir     string
+	results map[*plan]*result
+	streams []Stream          // streams opened by iterate
+	actual  map[*plan]*actual // records of evaluations if explained
+
+	start     time.Time
+	nodes     int   // number of nodes of the plans
+	evaluated int64 // number of nodes evaluated, updated atomically
+	output    int64 // number of values of results passed on
+}
+
+// result is the value of a node used several times.
+type result struct {
+	done    chan struct{} // closed when the value is computed
+	v       *set
+	err     error
+	uses    int  // uses left
+	started bool // whether a use computes the value
+	skipped int  // uses skipped before the value was started
+}
+
+func newEvaluator(c config, plans []*plan) *evaluator {
+	e := &evaluator{r: c.resolver, limit: c.limit, results: map[*plan]*result{}, start: time.Now(), nodes: size(plans)}
+	if c.workers > 1 {
+		e.sem = make(chan struct{}, c.workers-1)
+	}
+
+	if c.explain != nil {
+		e.actual = map[*plan]*actual{}
+	}
+
+	return e
+}
+
+// eval evaluates the node. The operands of an expression are evaluated
+// concurrently if workers are free, otherwise in the order of the plan.
+// INT and DIF evaluate their first operands before the others and stop
+// if they are empty. Every use of the value must release it.
+func (e *evaluator) eval(ctx context.Context, p *plan) (*set, error) {
+	if p.refs > 1 {
+		return e.shared(p, func() (*set, error) {
+			s, err := e.record(ctx, p)
+			if err == nil {
+				s.refs = int32(p.refs)
+			}
+
+			return s, err
+		})
+	}
+
+	return e.record(ctx, p)
+}
+
+// shared returns the value of the node used several times. The first use
+// computes the value with fn, the others wait for it. The value is dropped
+// after the last use.
+func (e *evaluator) shared(p *plan, fn func() (*set, error)) (*set, error) {
+	e.mu.Lock()
+
+	r := e.result(p)
+	start := !r.started
+	r.started = true
+	e.mu.Unlock()
+
+	if start {
+		r.v, r.err = fn()
+
+		for i := 0; r.v != nil && i < r.skipped; i++ {
+			e.release(r.v)
+		}
+
+		close(r.done)
+	}
+
+	<-r.done
+
+	return r.v, r.err
+}
+
+// result returns the result of the node counting a use of it. e.mu must
+// be held.
+func (e *evaluator) result(p *plan) *result {
+	r, ok := e.results[p]
+	if !ok {
+		r = &result{done: make(chan struct{}), uses: p.refs}
+		e.results[p] = r
+	}
+
+	if r.uses--; r.uses == 0 {
+		delete(e.results, p)
+	}
+
+	return r
+}
+
+// skip drops a use of the node whose value is not needed. Values of nodes
+// used several times are released, or not computed if all the uses are
+// skipped.
+func (e *evaluator) skip(p *plan) {
+	if p.refs > 1 {
+		e.mu.Lock()
+
+		r := e.result(p)
+		if !r.started {
+			r.skipped++
+			last := r.uses == 0
+			e.mu.Unlock()
+
+			if !last {
+				return
+			}
+		} else {
+			e.mu.Unlock()
+
+			if <-r.done; r.v != nil {
+				e.release(r.v)
+			}
+
+			return
+		}
+	}
+
+	for _, arg := range p.args {
+		e.skip(arg)
+	}
+}
+
+// record computes the value of the node recording the evaluation if explained.
+func (e *evaluator) record(ctx context.Context, p *plan) (*set, error) {
+	start := time.Now()
+
+	s, err := e.compute(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&e.evaluated, 1)
+
+	if e.actual != nil {
+		a := e.observe(p)
+		a.evals++
+		a.card += s.n
+		a.time += time.Since(start)
+
+		if s.file != "" {
+			a.spills++
+		}
+
+		if p.op == parser.TokenIdentifier && p.est.Bytes > 0 {
+			a.bytes += p.est.Bytes
+		}
+	}
+
+	return s, nil
+}
 
-	err = ast.Apply(func(n *parser.Node, err error) error {
+func (e *evaluator) compute(ctx context.Context, p *plan) (*set, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	switch p.op {
+	case parser.TokenIdentifier:
+		v, err := resolve(ctx, e.r, p.name)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		stack = append(stack, n)
-		return nil
+		return e.keep(v)
+	case parser.TokenRange:
+		if !e.fits(uint64(p.hi - p.lo)) {
+			return e.store(ctx, sets.NewRangeIterator(p.lo, p.hi))
+		}
+
+		v, err := literal(p.lo, p.hi)
+		if err != nil {
+			return nil, err
+		}
+
+		return e.keep(v)
+	}
+
+	var (
+		vals   = make([]*set, len(p.args))
+		ranges = windows(p)
+		first  int
+	)
+
+	defer func() {
+		for _, s := range vals {
+			if s != nil {
+				e.release(s)
+			}
+		}
+	}()
+
+	if len(p.args) > 0 && !ranges[0] && (p.op == parser.TokenINT || p.op == parser.TokenDIF) {
+		s, err := e.eval(ctx, p.args[0])
+		if err != nil {
+			return nil, err
+		}
+
+		vals[0], first = s, 1
+
+		if s.n == 0 {
+			// the rest of the operands are not needed.
+			for _, arg := range p.args[1:] {
+				e.skip(arg)
+			}
+
+			return &set{refs: 1}, nil
+		}
+	}
+
+	err := e.each(ctx, len(p.args)-first, func(ctx context.Context, i int) error {
+		if ranges[first+i] {
+			e.skip(p.args[first+i])
+			return nil
+		}
+
+		s, err := e.eval(ctx, p.args[first+i])
+		vals[first+i] = s
+
+		return err
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	data := sets.TestData(100, 100)
+	if v, ok := inMemory(vals); ok && e.reserve(valueSize*bound(p, vals)) {
+		res, err := apply(ctx, p, v)
+		e.unreserve(valueSize * bound(p, vals))
+
+		if err != nil {
+			return nil, err
+		}
+
+		return e.keep(res)
+	}
+
+	its := make([]sets.Iterator, len(vals))
 
-	var acc []int64
-	for i := 0; i < len(stack); i++ {
-		acc, err = processCommand(stack[i], data, acc...)
+	for i, s := range vals {
+		if ranges[i] {
+			its[i] = sets.NewRangeIterator(p.args[i].lo, p.args[i].hi)
+			continue
+		}
+
+		r, err := e.read(s)
 		if err != nil {
 			return nil, err
 		}
+		defer r.Close()
+
+		its[i] = r
+	}
+
+	it, err := merge(p, its)
+	if err != nil {
+		return nil, err
 	}
 
-	return acc, nil
+	return e.store(ctx, it)
 }
 
-func processCommand(n *parser.Node, data map[string][]int64, accum ...int64) ([]int64, error) {
-	var vals [][]int64
+// fits reports whether the values of a range of n+1 integers are made
+// in memory.
+func (e *evaluator) fits(n uint64) bool {
+	return e.limit <= 0 || n < uint64(e.limit/valueSize)
+}
 
-	for i := range n.Vals() {
-		if v, ok := data[string(rune(n.Vals()[i][0]))]; ok {
-			vals = append(vals, sortutil.DeDupInt64(sortutil.SortInt64(v)))
-		} else {
-			return nil, fmt.Errorf("data not found for %v", n.Vals()[i][0])
+// windows reports the operands of the node that are ranges merged as
+// iterators, as the values of INT are bounded by the other operands and
+// DIF only skips the values of its subtrahends, so ranges are not made.
+func windows(p *plan) []bool {
+	w := make([]bool, len(p.args))
+
+	for i, arg := range p.args {
+		w[i] = arg.op == parser.TokenRange &&
+			(p.op == parser.TokenINT || p.op == parser.TokenDIF && i > 0)
+	}
+
+	return w
+}
+
+// inMemory returns the values of the sets if all of them are kept in memory.
+func inMemory(vals []*set) ([][]int64, bool) {
+	v := make([][]int64, len(vals))
+
+	for i, s := range vals {
+		if s == nil || s.file != "" {
+			return nil, false
 		}
+
+		v[i] = s.v
 	}
 
-	if len(accum) > 0 {
-		vals = append(vals, accum)
+	return v, true
+}
+
+// bound returns the greatest number of values of the result of the node.
+func bound(p *plan, vals []*set) int64 {
+	var n int64
+
+	for i, s := range vals {
+		switch {
+		case p.op == parser.TokenDIF:
+			return vals[0].n
+		case p.op == parser.TokenINT && (i == 0 || s.n < n):
+			n = s.n
+		case p.op != parser.TokenINT:
+			n += s.n
+		}
 	}
 
-	var out []int64
+	return n
+}
+
+// mergeChunk is the number of values of the largest operand merged by apply
+// between checks of the context.
+const mergeChunk = 1 << 16
 
-	switch n.Type() {
+// apply applies the operator of the node to the values of its operands.
+// Operators decide on every value by the operands having it, so apply
+// merges the operands in chunks of values checking the context between them.
+func apply(ctx context.Context, p *plan, vals [][]int64) ([]int64, error) {
+	var big []int64
+
+	for _, v := range vals {
+		if len(v) > len(big) {
+			big = v
+		}
+	}
+
+	if len(big) <= mergeChunk || ctx.Done() == nil {
+		return operator(p, vals)
+	}
+
+	var (
+		out  []int64
+		rest = append([][]int64(nil), vals...)
+		sub  = make([][]int64, len(vals))
+	)
+
+	for i := 0; i < len(big); i += mergeChunk {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		for j, v := range rest {
+			n := len(v)
+			if i+mergeChunk < len(big) {
+				bound := big[i+mergeChunk]
+				n = sort.Search(len(v), func(k int) bool { return v[k] >= bound })
+			}
+
+			sub[j], rest[j] = v[:n], v[n:]
+		}
+
+		res, err := operator(p, sub)
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, res...)
+	}
+
+	return out, nil
+}
+
+// operator applies the operator of the node to the values of its operands.
+func operator(p *plan, vals [][]int64) ([]int64, error) {
+	switch p.op {
 	case parser.TokenSUM:
-		out = sets.UnionInt64Sorted(vals...)
+		if dense(vals) {
+			return sets.UnionBitmap(bitmaps(vals)...).Int64s(), nil
+		}
+
+		return sets.UnionInt64Sorted(vals...), nil
 	case parser.TokenINT:
-		out = sets.InterInt64Sorted(vals...)
+		vals = append([][]int64(nil), vals...)
+		sort.SliceStable(vals, func(i, j int) bool {
+			return len(vals[i]) < len(vals[j])
+		})
+
+		return sets.InterInt64Sorted(vals...), nil
 	case parser.TokenDIF:
-		out = sets.DiffInt64Sorted(vals...)
-	default:
-		return nil, fmt.Errorf("unknown command %v", n.Type())
+		if dense(vals) {
+			return sets.DiffBitmap(bitmaps(vals)...).Int64s(), nil
+		}
+
+		return sets.DiffInt64Sorted(vals...), nil
+	case parser.TokenXOR:
+		return sets.XorInt64Sorted(vals...), nil
+	case parser.TokenONE:
+		return sets.OneInt64Sorted(vals...), nil
+	case parser.TokenATLEAST:
+		return sets.AtLeastInt64Sorted(p.k, vals...), nil
+	case parser.TokenATMOST:
+		return sets.AtMostInt64Sorted(p.k, vals...), nil
+	}
+
+	return nil, fmt.Errorf("unknown command %v", p.op)
+}
+
+// dense reports whether the operands are combined faster as bitmaps: at
+// least two of them have values and all of those are dense. Intersections
+// are merged anyway, as merging them is cheaper than making the bitmaps.
+func dense(vals [][]int64) bool {
+	n := 0
+
+	for _, v := range vals {
+		if len(v) == 0 {
+			continue
+		}
+
+		if !sets.Dense(v) {
+			return false
+		}
+
+		n++
+	}
+
+	return n > 1
+}
+
+func bitmaps(vals [][]int64) []*sets.Bitmap {
+	res := make([]*sets.Bitmap, len(vals))
+	for i, v := range vals {
+		res[i] = sets.NewBitmap(v)
+	}
+
+	return res
+}
+
+// each calls fn for indexes from 0 to n-1, concurrently while workers are
+// free and in order otherwise. The first failure cancels the context of the
+// calls in progress and prevents the calls not started. each returns the
+// error of the least index not caused by the cancellation.
+func (e *evaluator) each(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		errs = make([]error, n)
+		wg   sync.WaitGroup
+	)
+
+	call := func(i int) {
+		if errs[i] = fn(ctx, i); errs[i] != nil {
+			cancel()
+		}
+	}
+
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		select {
+		case e.sem <- struct{}{}:
+			wg.Add(1)
+
+			go func(i int) {
+				defer func() {
+					<-e.sem
+					wg.Done()
+				}()
+
+				call(i)
+			}(i)
+		default:
+			call(i)
+		}
+	}
+
+	wg.Wait()
+
+	var first error
+
+	for _, err := range errs {
+		switch {
+		case err == nil:
+		case !errors.Is(err, context.Canceled):
+			return err
+		case first == nil:
+			first = err
+		}
+	}
+
+	if first == nil {
+		first = ctx.Err() // cancelled before all calls started
+	}
+
+	return first
+}
+
+// maxLiteral limits the size of ranges made in memory.
+const maxLiteral = 1 << 28
+
+// literal makes the set of the range.
+func literal(lo, hi int64) ([]int64, error) {
+	if uint64(hi-lo) >= maxLiteral {
+		return nil, fmt.Errorf("range %d..%d is too large to make in memory", lo, hi)
+	}
+
+	out := make([]int64, 0, hi-lo+1)
+	for i := int64(0); i <= hi-lo; i++ {
+		out = append(out, lo+i)
 	}
 
 	return out, nil
 }
+
+// bounds returns the bounds of a number or a range.
+// The values are validated by the parser.
+func bounds(n *parser.Node) (lo, hi int64) {
+	vals := n.Vals()
+	lo, _ = strconv.ParseInt(vals[0], 10, 64)
+	hi, _ = strconv.ParseInt(vals[len(vals)-1], 10, 64)
+
+	return lo, hi
+}
@@ -0,0 +1,1098 @@
+package calc_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runningmaster/sc/internal/calc"
+	"github.com/runningmaster/sc/internal/setfile"
+	"github.com/runningmaster/sc/internal/testutil"
+)
+
+var testSets = calc.MapResolver{ //nolint: gochecknoglobals
+	"a": {1, 2, 3, 4, 5, 6},
+	"b": {2, 3},
+	"c": {3, 4, 7},
+	"d": {1, 4, 5, 8},
+	"e": {4, 5, 9},
+}
+
+var ttExecute = []struct { //nolint: gochecknoglobals
+	in  string
+	out []int64
+}{
+	{`[SUM b c]`, []int64{2, 3, 4, 7}},
+	{`[INT a c]`, []int64{3, 4}},
+	{`[DIF a b]`, []int64{1, 4, 5, 6}},
+	{`[DIF b a]`, []int64{}},
+	{`[DIF a [SUM b c]]`, []int64{1, 5, 6}},
+	{`[DIF [SUM b c] a]`, []int64{7}},
+	{`[DIF [SUM b c] [INT a b]]`, []int64{4, 7}},
+	{`[DIF a [SUM b c] [INT d e]]`, []int64{1, 6}},
+	{`[DIF [INT d e] a [SUM b c]]`, []int64{}},
+	{`[SUM [INT a b] [INT c d] [INT d e]]`, []int64{2, 3, 4, 5}},
+	{`[INT a [SUM b [DIF c [INT d [SUM e b]]]] [SUM c e]]`, []int64{3}},
+	{`[SUM [SUM [SUM [SUM [SUM e]]]]]`, []int64{4, 5, 9}},
+	{`[DIF [DIF [DIF a b] c] d]`, []int64{6}},
+	{`[XOR a b]`, []int64{1, 4, 5, 6}},
+	{`[XOR c d e]`, []int64{1, 3, 4, 7, 8, 9}},
+	{`[ONE c d e]`, []int64{1, 3, 7, 8, 9}},
+	{`[ONE a [XOR b c]]`, []int64{1, 3, 5, 6, 7}},
+	{`[ATLEAST 2 a b c d e]`, []int64{1, 2, 3, 4, 5}},
+	{`[ATLEAST 4 a b c d e]`, []int64{4}},
+	{`[ATMOST 1 a b c d e]`, []int64{6, 7, 8, 9}},
+	{`[ATMOST 0 a b]`, []int64{}},
+	{`[DIF a {1,2,3}]`, []int64{4, 5, 6}},
+	{`[INT a 3..10]`, []int64{3, 4, 5, 6}},
+	{`[SUM {-2, 0..1, 7} {}]`, []int64{-2, 0, 1, 7}},
+	{`[SUM {3, 1..2, 2}]`, []int64{1, 2, 3}},
+	{`[INT {} a]`, []int64{}},
+	{`[SUM -3..-1 9223372036854775806..9223372036854775807]`,
+		[]int64{-3, -2, -1, 9223372036854775806, 9223372036854775807}},
+	{`[INT a 2..1000000000]`, []int64{2, 3, 4, 5, 6}},
+	{`[INT a 0..100000000 4..1000000000000]`, []int64{4, 5, 6}},
+	{`[INT -5..2 0..1000000000]`, []int64{0, 1, 2}},
+	{`[DIF a 3..1000000000 b]`, []int64{1}},
+	{`[DIF c -9223372036854775808..3]`, []int64{4, 7}},
+	{`[LET x [SUM b c] [DIF x [INT x d]]]`, []int64{2, 3, 7}},
+	{`[LET x [SUM b c] [LET y [INT x e] [SUM y {100}]]]`, []int64{4, 100}},
+	{`[LET a {9} [SUM a "a"]]`, []int64{1, 2, 3, 4, 5, 6, 9}},
+	{`[LET x b [LET x [SUM x c] x]]`, []int64{2, 3, 4, 7}},
+	{`[SUM [LET x b x] [LET x e x]]`, []int64{2, 3, 4, 5, 9}},
+}
+
+func TestExecute(t *testing.T) {
+	for i, tt := range ttExecute {
+		out, err := calc.Execute(tt.in, calc.WithResolver(testSets))
+		if err != nil {
+			t.Errorf("pos %v: %v", i, err)
+			continue
+		}
+
+		if len(out) == 0 && len(tt.out) == 0 {
+			continue
+		}
+
+		if !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+	}
+}
+
+func TestExecuteNotFound(t *testing.T) {
+	for i, in := range []string{`[SUM a [INT b x]]`, `[INT {} x]`} {
+		_, err := calc.Execute(in, calc.WithResolver(testSets))
+		if !errors.Is(err, calc.ErrNotFound) {
+			t.Errorf("pos %v: got %v, want %v", i, err, calc.ErrNotFound)
+		}
+	}
+}
+
+var ttExecuteOnce = []struct { //nolint: gochecknoglobals
+	in  string
+	out []int64
+}{
+	{`[DIF [SUM a b] [INT [SUM b a] c]]`, []int64{1, 2, 5, 6}},
+	{`[SUM c [INT c d] [DIF c e]]`, []int64{3, 4, 7}},
+	{`[XOR [INT a b] [INT b a] [DIF d a e] [DIF d e a]]`, []int64{}},
+	{`[LET x [SUM b c] [SUM x [INT x b c]]]`, []int64{2, 3, 4, 7}},
+}
+
+func TestExecuteOnce(t *testing.T) {
+	for i, tt := range ttExecuteOnce {
+		r := newCountingResolver()
+
+		out, err := calc.Execute(tt.in, calc.WithResolver(r))
+		if err != nil {
+			t.Errorf("pos %v: %v", i, err)
+			continue
+		}
+
+		if len(out)+len(tt.out) > 0 && !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+
+		for name, n := range r.reads {
+			if n != 1 {
+				t.Errorf("pos %v: %s: got %v reads, want 1", i, name, n)
+			}
+		}
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	for _, n := range []int{1, 2, 8} {
+		for i, tt := range ttExecute {
+			out, err := calc.Execute(tt.in, calc.WithResolver(testSets), calc.WithWorkers(n))
+			if err != nil {
+				t.Errorf("workers %v pos %v: %v", n, i, err)
+				continue
+			}
+
+			if len(out)+len(tt.out) > 0 && !reflect.DeepEqual(out, tt.out) {
+				t.Errorf("workers %v pos %v: got %v, want %v", n, i, out, tt.out)
+			}
+		}
+	}
+}
+
+func TestWorkersLimit(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		active, max int
+	)
+
+	r := calc.ResolverFunc(func(name string) ([]int64, error) {
+		mu.Lock()
+		if active++; active > max {
+			max = active
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+
+		return []int64{int64(len(name))}, nil
+	})
+
+	in := `[SUM a b c d e f g h [INT i j k l] [DIF m n o p] q r s t]`
+
+	out, err := calc.Execute(in, calc.WithResolver(r), calc.WithWorkers(4))
+	if err != nil || !reflect.DeepEqual(out, []int64{1}) {
+		t.Errorf("got %v (%v), want %v", out, err, []int64{1})
+	}
+
+	if max < 2 || max > 4 {
+		t.Errorf("got %v operands resolved concurrently, want 2 to 4", max)
+	}
+}
+
+func TestWorkersError(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		reads []string
+	)
+
+	r := calc.ResolverFunc(func(name string) ([]int64, error) {
+		mu.Lock()
+		reads = append(reads, name)
+		mu.Unlock()
+
+		if len(name) > 1 {
+			return nil, errors.New("bad " + name)
+		}
+
+		time.Sleep(time.Millisecond)
+
+		return testSets.Resolve(name)
+	})
+
+	for _, n := range []int{1, 2, 8} {
+		reads = nil
+
+		// with workers, the failure of either branch may cancel the other.
+		_, err := calc.Execute(`[SUM a [INT b x1] [DIF c x2] d e]`, calc.WithResolver(r), calc.WithWorkers(n))
+		if err == nil || err.Error() != "bad x1" && (n == 1 || err.Error() != "bad x2") {
+			t.Errorf("workers %v: got %v, want bad x1", n, err)
+		}
+
+		if n == 1 && !reflect.DeepEqual(reads, []string{"a", "b", "x1"}) {
+			t.Errorf("workers %v: got reads %v, want %v", n, reads, []string{"a", "b", "x1"})
+		}
+	}
+}
+
+func TestExecuteContextCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	opt := calc.WithResolver(testSets)
+
+	_, err := calc.ExecuteContext(ctx, `[SUM a b]`, opt)
+	checkInterrupted(t, "execute", err, context.Canceled)
+
+	err = calc.ExecuteStreamContext(ctx, `[SUM a b]`, func(int64) error { return nil }, opt)
+	checkInterrupted(t, "stream", err, context.Canceled)
+
+	err = calc.ExecuteScriptContext(ctx, "print [SUM a b]", func([]int64) error { return nil }, opt)
+	checkInterrupted(t, "script", err, context.Canceled)
+}
+
+func TestExecuteContextDeadline(t *testing.T) {
+	r := calc.ResolverFunc(func(name string) ([]int64, error) {
+		if name == "slow" {
+			time.Sleep(50 * time.Millisecond)
+			name = "a"
+		}
+
+		return testSets.Resolve(name)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := calc.ExecuteContext(ctx, `[SUM a slow [INT b c]]`, calc.WithResolver(r), calc.WithWorkers(1))
+	checkInterrupted(t, "execute", err, context.DeadlineExceeded)
+
+	var ie *calc.InterruptedError
+	if errors.As(err, &ie) && ie.Progress.Evaluated != 2 {
+		t.Errorf("got %v nodes evaluated, want 2", ie.Progress.Evaluated)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	var n int64
+
+	err = calc.ExecuteStreamContext(ctx, `[SUM 0..9223372036854775806]`, func(int64) error {
+		n++
+		return nil
+	})
+	checkInterrupted(t, "stream", err, context.DeadlineExceeded)
+
+	if errors.As(err, &ie) && ie.Progress.Output != n {
+		t.Errorf("got %v values passed on, want %v", ie.Progress.Output, n)
+	}
+}
+
+func checkInterrupted(t *testing.T, name string, err, want error) {
+	t.Helper()
+
+	var ie *calc.InterruptedError
+	if !errors.As(err, &ie) || !errors.Is(err, want) {
+		t.Errorf("%s: got %v, want interrupted by %v", name, err, want)
+	}
+}
+
+// randomSets returns the sets a, b and c of about half of the integers
+// from 0 to n-1.
+func randomSets(n int64) calc.MapResolver {
+	var (
+		r   = calc.MapResolver{}
+		rnd = rand.New(rand.NewSource(1))
+	)
+
+	for _, name := range []string{"a", "b", "c"} {
+		v := make([]int64, 0, n/2)
+		for i := int64(0); i < n; i++ {
+			if rnd.Intn(2) == 0 {
+				v = append(v, i)
+			}
+		}
+
+		r[name] = v
+	}
+
+	return r
+}
+
+var ttRandom = []string{ //nolint: gochecknoglobals
+	`[SUM a b c]`, `[INT a b c]`, `[DIF a b c]`, `[XOR a b c]`, `[ATLEAST 2 a b c]`,
+	`[DIF [SUM a b] [INT b c]]`, `[LET x [XOR a c] [SUM [INT x b] [DIF x b]]]`,
+}
+
+func TestExecuteContextChunks(t *testing.T) {
+	r := randomSets(1 << 19)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, cmd := range ttRandom {
+		want, err := calc.Execute(cmd, calc.WithResolver(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := calc.ExecuteContext(ctx, cmd, calc.WithResolver(r))
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v values, %v, want %v values", cmd, len(got), err, len(want))
+		}
+	}
+}
+
+func TestDenseOperands(t *testing.T) {
+	r := randomSets(1 << 17)
+
+	for _, cmd := range ttRandom {
+		got, err := calc.Execute(cmd, calc.WithResolver(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var want []int64
+
+		err = calc.ExecuteStream(cmd, func(v int64) error {
+			want = append(want, v)
+			return nil
+		}, calc.WithResolver(r))
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v values, %v, want %v values", cmd, len(got), err, len(want))
+		}
+	}
+}
+
+func TestMemoryLimit(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	r := randomSets(1 << 14)
+
+	for _, limit := range []int64{1, 1 << 10, 1 << 16} {
+		for _, n := range []int{1, 4} {
+			opts := []calc.Option{calc.WithMemoryLimit(limit), calc.WithWorkers(n)}
+
+			for i, tt := range ttExecute {
+				out, err := calc.Execute(tt.in, append(opts, calc.WithResolver(testSets))...)
+				if err != nil || len(out)+len(tt.out) > 0 && !reflect.DeepEqual(out, tt.out) {
+					t.Errorf("limit %v, pos %v: got %v, %v, want %v", limit, i, out, err, tt.out)
+				}
+			}
+
+			for _, cmd := range ttRandom {
+				want, _ := calc.Execute(cmd, calc.WithResolver(r))
+
+				got, err := calc.Execute(cmd, append(opts, calc.WithResolver(r))...)
+				if err != nil || !reflect.DeepEqual(got, want) {
+					t.Errorf("limit %v, %s: got %v values, %v, want %v values", limit, cmd, len(got), err, len(want))
+				}
+			}
+
+			checkEmpty(t, dir)
+		}
+	}
+}
+
+func TestMemoryLimitCleanup(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	bad := calc.ResolverFunc(func(name string) ([]int64, error) {
+		if name == "bad" {
+			return nil, errors.New("bad set")
+		}
+
+		return testSets.Resolve(name)
+	})
+
+	opts := []calc.Option{calc.WithMemoryLimit(8), calc.WithWorkers(1), calc.WithResolver(bad)}
+
+	_, err := calc.Execute(`[DIF [SUM a 10..100000] [SUM b 0..5] bad]`, opts...)
+	if err == nil || err.Error() != "bad set" {
+		t.Errorf("got %v, want bad set", err)
+	}
+
+	checkEmpty(t, dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = calc.ExecuteContext(ctx, `[INT [SUM a 0..9223372036854775806] b]`, opts...)
+	checkInterrupted(t, "execute", err, context.DeadlineExceeded)
+	checkEmpty(t, dir)
+
+	var (
+		out  [][]int64
+		file = filepath.Join(dir, "out.txt")
+	)
+
+	err = calc.ExecuteScript("x = [SUM a 10..20000]\nprint [INT x c]\nwrite \""+file+"\" [DIF x b]",
+		func(v []int64) error {
+			out = append(out, v)
+			return nil
+		}, opts...)
+	if err != nil || !reflect.DeepEqual(out, [][]int64{{3, 4}}) {
+		t.Errorf("got %v, %v, want %v", out, err, [][]int64{{3, 4}})
+	}
+
+	v, err := setfile.ReadFile(file)
+	if err != nil || len(v) != 19995 || v[0] != 1 || v[len(v)-1] != 20000 {
+		t.Errorf("got %v values, %v, want 19995 values from 1 to 20000", len(v), err)
+	}
+
+	_ = os.Remove(file)
+	checkEmpty(t, dir)
+
+	var b strings.Builder
+
+	_, err = calc.Execute(`[SUM a 10..100000]`, append(opts, calc.WithExplain(&b))...)
+	if err != nil || !strings.Contains(b.String(), "spills=1") {
+		t.Errorf("got %q, %v, want spills in the report", b.String(), err)
+	}
+}
+
+func TestMemoryLimitSkipped(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	files := -1
+	r := calc.ResolverFunc(func(name string) ([]int64, error) {
+		switch name {
+		case "empty":
+			return nil, nil
+		case "probe":
+			files = 0
+			err := filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+				if err == nil && !fi.IsDir() {
+					files++
+				}
+
+				return err
+			})
+
+			return nil, err
+		}
+
+		return testSets.Resolve(name)
+	})
+
+	// the use of the shared SUM skipped by INT releases its spilled value
+	// after DIF, before probe is read.
+	cmd := `[SUM [INT empty [SUM a 10..20]] [DIF [SUM a 10..20] 0..100] probe]`
+
+	out, err := calc.Execute(cmd, calc.WithMemoryLimit(8), calc.WithWorkers(1), calc.WithResolver(r))
+	if err != nil || len(out) != 0 || files != 0 {
+		t.Errorf("got %v, %v, %v files left, want none", out, err, files)
+	}
+
+	checkEmpty(t, dir)
+}
+
+// tempDir makes a temporary directory the default one until cleanup.
+func tempDir(t *testing.T) (dir string, cleanup func()) {
+	t.Helper()
+
+	dir, remove := testutil.TempDir(t)
+	tmp := os.Getenv("TMPDIR")
+	os.Setenv("TMPDIR", dir)
+
+	return dir, func() {
+		os.Setenv("TMPDIR", tmp)
+		remove()
+	}
+}
+
+func checkEmpty(t *testing.T, dir string) {
+	t.Helper()
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil || len(files) > 0 {
+		t.Errorf("got %v files left in %s, %v, want none", len(files), dir, err)
+	}
+}
+
+// countingResolver resolves testSets telling their statistics and counting reads.
+type countingResolver struct {
+	mu    sync.Mutex
+	reads map[string]int
+}
+
+func newCountingResolver() *countingResolver {
+	return &countingResolver{reads: map[string]int{}}
+}
+
+func (c *countingResolver) Resolve(name string) ([]int64, error) {
+	c.mu.Lock()
+	c.reads[name]++
+	c.mu.Unlock()
+
+	return testSets.Resolve(name)
+}
+
+func (c *countingResolver) Stat(name string) (calc.Stats, error) {
+	return testSets.Stat(name)
+}
+
+var ttOptimize = []struct { //nolint: gochecknoglobals
+	in    string
+	out   []int64
+	reads string
+}{
+	{`[INT a {100}]`, []int64{}, ""},
+	{`[INT a [SUM b c] 7..9]`, []int64{}, ""},
+	{`[INT [SUM a b] [INT c d e]]`, []int64{4}, "abcde"},
+	{`[INT [DIF b b] c d]`, []int64{}, "b"},
+	{`[INT a {}]`, []int64{}, ""},
+	{`[DIF {} a]`, []int64{}, ""},
+	{`[DIF b e {100} [SUM 7..9 e]]`, []int64{2, 3}, "b"},
+	{`[DIF [SUM b e] {8..10}]`, []int64{2, 3, 4, 5}, "be"},
+	{`[DIF [SUM b e] {3, 9}]`, []int64{2, 4, 5}, "be"},
+	{`[DIF [DIF a b] [SUM c [SUM d e]]]`, []int64{6}, "abcde"},
+	{`[SUM a [SUM b {}] [SUM [SUM c]]]`, []int64{1, 2, 3, 4, 5, 6, 7}, "abc"},
+	{`[XOR a [XOR b c] [XOR b c]]`, []int64{1, 2, 3, 4, 5, 6}, "abc"},
+	{`[INT [INT a] b]`, []int64{}, ""},
+	{`[INT [INT a b]]`, []int64{}, ""},
+	{`[INT [SUM a b]]`, []int64{}, ""},
+	{`[INT [INT a c] [INT d e]]`, []int64{4}, "acde"},
+	{`[ATLEAST 2 a b {} c]`, []int64{2, 3, 4}, "abc"},
+}
+
+func TestOptimize(t *testing.T) {
+	for i, tt := range ttOptimize {
+		r := newCountingResolver()
+
+		out, err := calc.Execute(tt.in, calc.WithResolver(r))
+		if err != nil {
+			t.Errorf("pos %v: %v", i, err)
+			continue
+		}
+
+		if len(out)+len(tt.out) > 0 && !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+
+		var reads []byte
+		for name := range r.reads {
+			reads = append(reads, name...)
+		}
+
+		sort.Slice(reads, func(i, j int) bool { return reads[i] < reads[j] })
+
+		if string(reads) != tt.reads {
+			t.Errorf("pos %v: got reads %q, want %q", i, reads, tt.reads)
+		}
+
+		out = nil
+
+		err = calc.ExecuteStream(tt.in, func(v int64) error {
+			out = append(out, v)
+			return nil
+		}, calc.WithResolver(testSets))
+		if err != nil {
+			t.Errorf("pos %v: stream: %v", i, err)
+			continue
+		}
+
+		if len(out)+len(tt.out) > 0 && !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: stream: got %v, want %v", i, out, tt.out)
+		}
+	}
+}
+
+var ttExplain = []struct { //nolint: gochecknoglobals
+	stream bool
+	out    string
+}{
+	{false, `parsed:
+DIF
+├─ SUM
+│  ├─ "c"
+│  └─ "b"
+├─ {100}
+└─ "b"
+plan:
+DIF  est=~5 card=2 bytes=0
+├─ SUM  est=~5 card=4 bytes=0
+│  ├─ "b"  est=2 card=2 bytes=0
+│  └─ "c"  est=3 card=3 bytes=0
+└─ "b" (see above)
+`},
+	{true, `parsed:
+DIF
+├─ SUM
+│  ├─ "c"
+│  └─ "b"
+├─ {100}
+└─ "b"
+plan:
+DIF  est=~5 card=2 bytes=0
+├─ SUM  est=~5 card=4 bytes=0
+│  ├─ "b"  est=2 card=2 bytes=0
+│  └─ "c"  est=3 card=3 bytes=0
+└─ "b" (see above)
+`},
+}
+
+func TestExplain(t *testing.T) {
+	const in = `[DIF [SUM c b] {100} b]`
+
+	times := regexp.MustCompile(` time=\S+`)
+
+	for i, tt := range ttExplain {
+		var (
+			b   strings.Builder
+			err error
+		)
+
+		if tt.stream {
+			err = calc.ExecuteStream(in, func(int64) error { return nil },
+				calc.WithResolver(testSets), calc.WithExplain(&b))
+		} else {
+			_, err = calc.Execute(in, calc.WithResolver(testSets), calc.WithExplain(&b))
+		}
+
+		if err != nil {
+			t.Errorf("pos %v: %v", i, err)
+			continue
+		}
+
+		if out := times.ReplaceAllString(b.String(), ""); out != tt.out {
+			t.Errorf("pos %v: got\n%s\nwant\n%s", i, out, tt.out)
+		}
+	}
+}
+
+func TestExecuteStream(t *testing.T) {
+	for i, tt := range ttExecute {
+		var out []int64
+
+		err := calc.ExecuteStream(tt.in, func(v int64) error {
+			out = append(out, v)
+			return nil
+		}, calc.WithResolver(testSets))
+		if err != nil {
+			t.Errorf("pos %v: %v", i, err)
+			continue
+		}
+
+		if len(out) == 0 && len(tt.out) == 0 {
+			continue
+		}
+
+		if !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+	}
+}
+
+func TestExecuteStreamFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, data := range map[string]string{
+		"a.txt": "1\n2\n2\n3\n5\n",
+		"b.txt": "2\n\n5\n8\n",
+		"c.txt": "3\n1\n",
+	} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out []int64
+
+	err = calc.ExecuteStream(`[DIF a.txt b.txt]`, func(v int64) error {
+		out = append(out, v)
+		return nil
+	}, calc.WithResolver(calc.DirResolver{Dir: dir}))
+	if err != nil || !reflect.DeepEqual(out, []int64{1, 3}) {
+		t.Errorf("got %v (%v), want %v", out, err, []int64{1, 3})
+	}
+
+	err = calc.ExecuteStream(`[SUM a.txt c.txt]`, func(v int64) error {
+		return nil
+	}, calc.WithResolver(calc.DirResolver{Dir: dir}))
+	if !errors.Is(err, setfile.ErrNotSorted) {
+		t.Errorf("got %v, want %v", err, setfile.ErrNotSorted)
+	}
+}
+
+var ttFileResolver = []struct { //nolint: gochecknoglobals
+	data   string
+	strict bool
+	out    []int64
+	line   int   // line of the error or the warning, 0 if none
+	err    error // error wrapped, nil if none
+}{
+	{"1\n2\n2\n\n5\n", true, []int64{1, 2, 5}, 0, nil},
+	{"1\n2\n2\n\n5\n", false, []int64{1, 2, 5}, 0, nil},
+	{"3\n5\n1\n2\n3\n", true, nil, 3, setfile.ErrNotSorted},
+	{"3\n5\n1\n2\n3\n", false, []int64{1, 2, 3, 5}, 3, nil},
+	{"1\n-2x\n", false, nil, 2, strconv.ErrSyntax},
+	{"1\n2.5\n", true, nil, 2, strconv.ErrSyntax},
+	{"-9223372036854775808\n9223372036854775807\n", true, []int64{-9223372036854775808, 9223372036854775807}, 0, nil},
+	{"1\n\n9223372036854775808\n", false, nil, 3, strconv.ErrRange},
+}
+
+func TestFileResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "a.txt")
+
+	for i, tt := range ttFileResolver {
+		if err = ioutil.WriteFile(name, []byte(tt.data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		var warn error
+
+		out, err := calc.FileResolver{Strict: tt.strict, Warn: func(err error) { warn = err }}.Resolve(name)
+		switch {
+		case tt.err == nil && err != nil:
+			t.Errorf("pos %v: got %v, want no error", i, err)
+		case tt.err == nil:
+			err = warn // the line of the warning is checked
+		case !errors.Is(err, tt.err):
+			t.Errorf("pos %v: got %v, want %v", i, err, tt.err)
+		}
+
+		var fe *setfile.Error
+		if errors.As(err, &fe) != (tt.line > 0) || tt.line > 0 && fe.Line != tt.line {
+			t.Errorf("pos %v: got %v, want line %v", i, err, tt.line)
+		}
+
+		if !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+	}
+}
+
+// bzip2Data is "1\n3\n5\n7\n" compressed with bzip2.
+var bzip2Data = []byte{ //nolint: gochecknoglobals
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x6a, 0x4b, 0xdf, 0x77, 0x00, 0x00,
+	0x02, 0x48, 0x00, 0x00, 0x10, 0x2a, 0x80, 0x20, 0x00, 0x21, 0x83, 0x41, 0x9a, 0x02, 0xe0, 0x4b,
+	0x8b, 0xb9, 0x22, 0x9c, 0x28, 0x48, 0x35, 0x25, 0xef, 0xbb, 0x80,
+}
+
+func TestFileResolverCompressed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var gz, zl bytes.Buffer
+
+	for w, b := range map[io.WriteCloser]*bytes.Buffer{gzip.NewWriter(&gz): &gz, zlib.NewWriter(&zl): &zl} {
+		_, _ = w.Write([]byte("1\n2\n3\n5\n8\n"))
+		_ = w.Close()
+
+		if b.Len() == 0 {
+			t.Fatal("nothing compressed")
+		}
+	}
+
+	for name, data := range map[string][]byte{
+		"a.txt.gz":  gz.Bytes(),
+		"b.txt.bz2": bzip2Data,
+		"c.z":       zl.Bytes(),
+		"d.txt":     []byte("80\n800\n"),
+	} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := calc.WithResolver(calc.DirResolver{Dir: dir})
+
+	out, err := calc.Execute(`[SUM [INT a.txt.gz b.txt.bz2 c.z] d.txt]`, r)
+	if want := []int64{1, 3, 5, 80, 800}; err != nil || !reflect.DeepEqual(out, want) {
+		t.Errorf("got %v, %v, want %v", out, err, want)
+	}
+
+	out = nil
+
+	err = calc.ExecuteStream(`[DIF c.z b.txt.bz2]`, func(v int64) error {
+		out = append(out, v)
+		return nil
+	}, r)
+	if want := []int64{2, 8}; err != nil || !reflect.DeepEqual(out, want) {
+		t.Errorf("stream: got %v, %v, want %v", out, err, want)
+	}
+}
+
+// binaryFile returns the binary set file of the values.
+func binaryFile(t *testing.T, v []int64) []byte {
+	var b bytes.Buffer
+
+	w := setfile.NewBinaryWriter(&b)
+	for _, n := range v {
+		if err := w.Write(n); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func TestBinaryFiles(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	var a []int64
+	for i := int64(0); i < 3*setfile.DefaultBlockLen; i++ {
+		a = append(a, 3*i)
+	}
+
+	b := []int64{-7, 5, 9000, 20001, 29997, 40000}
+
+	var (
+		gz   bytes.Buffer
+		full = binaryFile(t, b)
+	)
+
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write(full)
+	_ = zw.Close()
+
+	for name, data := range map[string][]byte{
+		"a.scb":    binaryFile(t, a),
+		"b.scb":    full,
+		"b.scb.gz": gz.Bytes(),
+		"empty":    binaryFile(t, nil),
+		"bad":      full[:50],          // cut in the index
+		"cut":      full[:len(full)-1], // cut in the last uvarint of the data
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := calc.WithResolver(calc.DirResolver{Dir: dir})
+	want := []int64{9000, 20001, 29997}
+
+	for _, cmd := range []string{`[INT a.scb b.scb]`, `[INT a.scb b.scb.gz]`, `[INT b.scb a.scb [SUM empty b.scb]]`} {
+		out, err := calc.Execute(cmd, r)
+		if err != nil || !reflect.DeepEqual(out, want) {
+			t.Errorf("%s: got %v, %v, want %v", cmd, out, err, want)
+		}
+
+		out = nil
+
+		err = calc.ExecuteStream(cmd, func(v int64) error {
+			out = append(out, v)
+			return nil
+		}, r)
+		if err != nil || !reflect.DeepEqual(out, want) {
+			t.Errorf("stream %s: got %v, %v, want %v", cmd, out, err, want)
+		}
+	}
+
+	st, err := calc.DirResolver{Dir: dir}.Stat("b.scb")
+	if want := (calc.Stats{Card: 6, Exact: true, Min: -7, Max: 40000, Bounded: true, Bytes: st.Bytes}); err != nil || st != want {
+		t.Errorf("stat: got %+v, %v, want %+v", st, err, want)
+	}
+
+	for _, name := range []string{"[SUM bad]", "[INT a.scb bad]", "[SUM cut]", "[INT a.scb cut]"} {
+		if _, err := calc.Execute(name, r); !errors.Is(err, setfile.ErrCorrupt) {
+			t.Errorf("%s: got %v, want %v", name, err, setfile.ErrCorrupt)
+		}
+
+		err := calc.ExecuteStream(name, func(int64) error { return nil }, r)
+		if !errors.Is(err, setfile.ErrCorrupt) {
+			t.Errorf("stream %s: got %v, want %v", name, err, setfile.ErrCorrupt)
+		}
+	}
+}
+
+func TestStdin(t *testing.T) {
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+
+	for _, stream := range []bool{false, true} {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		go func() {
+			_, _ = w.Write([]byte("1\n4\n5\n"))
+			w.Close()
+		}()
+
+		os.Stdin = r
+
+		var (
+			out []int64
+			cmd = `[LET x - [SUM [INT x {1..3}] [DIF x {4}]]]`
+		)
+
+		if stream {
+			err = calc.ExecuteStream(cmd, func(v int64) error {
+				out = append(out, v)
+				return nil
+			})
+		} else {
+			out, err = calc.Execute(cmd)
+		}
+
+		r.Close()
+
+		if want := []int64{1, 5}; err != nil || !reflect.DeepEqual(out, want) {
+			t.Errorf("stream %v: got %v, %v, want %v", stream, out, err, want)
+		}
+	}
+
+	_, err := calc.Execute(`[SUM - [INT a -]]`, calc.WithResolver(testSets))
+	if err == nil || !strings.Contains(err.Error(), "more than once") {
+		t.Errorf("got %v, want an error of - used more than once", err)
+	}
+}
+
+var ttExpand = []struct { //nolint: gochecknoglobals
+	in  string
+	out []int64
+}{
+	{`[SUM "logs/2026-10-*.txt"]`, []int64{1, 2, 3, 5}},
+	{`[DIF logs/2026-10-*.txt]`, []int64{1, 3}},
+	{`[DIF "logs/2026-1?-0[12].txt" logs/2026-09-30.txt]`, []int64{1}},
+	{`[DIF logs {1}]`, []int64{}},
+	{`[LET x "logs/*-10-*" [DIF x logs/2026-10-02.txt]]`, []int64{1, 3}},
+	{`[SUM "a*.txt"]`, []int64{7}},
+	{`[SUM a "a*.txt"]`, []int64{1, 2, 3, 4, 5, 6, 7}},
+}
+
+// ttExpandMatches are expansions of no, one and several files with the
+// beginning of their plans.
+var ttExpandMatches = []struct { //nolint: gochecknoglobals
+	in   string
+	out  []int64
+	plan string
+	err  error
+}{
+	{`[SUM "logs/*.csv"]`, nil, "", calc.ErrNotFound},
+	{`[SUM empty]`, nil, "", calc.ErrNotFound},
+	{`[INT a dirs]`, nil, "", calc.ErrNotFound},
+	{`[SUM a "dirs/*"]`, nil, "", calc.ErrNotFound},
+	{`[SUM "logs/2026-09-*.txt"]`, []int64{3}, `"logs/2026-09-30.txt"`, nil},
+	{`[DIF "logs/2026-09-*.txt" c]`, []int64{}, "DIF\n├─ \"logs/2026-09-30.txt\"\n└─ \"c\"", nil},
+	{`[SUM logs]`, []int64{1, 2, 3, 5}, "SUM\n├─ \"logs/2026-09-30.txt\"\n├─ \"logs/2026-10-02.txt\"\n└─ \"logs/2026-10-01.txt\"", nil},
+	{`[DIF "logs/2026-10-*.txt"]`, []int64{1, 3}, "DIF\n├─ \"logs/2026-10-01.txt\"\n└─ \"logs/2026-10-02.txt\"", nil},
+}
+
+func TestExpand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"logs/sub", "empty", "dirs/sub"} {
+		if err = os.MkdirAll(filepath.Join(dir, name), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name, data := range map[string]string{
+		"logs/2026-10-01.txt": "1\n2\n3\n",
+		"logs/2026-10-02.txt": "2\n5\n",
+		"logs/2026-09-30.txt": "3\n",
+		"logs/sub/x.txt":      "9\n",
+		"a*.txt":              "7\n",
+	} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := calc.WithResolver(calc.MultiResolver{testSets, calc.DirResolver{Dir: dir}})
+
+	for i, tt := range ttExpand {
+		out, err := calc.Execute(tt.in, r)
+		if err != nil || len(out)+len(tt.out) > 0 && !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: got %v, %v, want %v", i, out, err, tt.out)
+		}
+	}
+
+	for i, tt := range ttExpandMatches {
+		var b bytes.Buffer
+
+		out, err := calc.Execute(tt.in, r, calc.WithExplain(&b))
+		if !errors.Is(err, tt.err) || len(out)+len(tt.out) > 0 && !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: got %v, %v, want %v, %v", i, out, err, tt.out, tt.err)
+			continue
+		}
+
+		if plan := planLines(b.String()); tt.err == nil && !strings.HasPrefix(plan, tt.plan) {
+			t.Errorf("pos %v: got plan %q, want %q", i, plan, tt.plan)
+		}
+	}
+}
+
+// planLines returns the lines of the plan printed by explain without
+// the statistics of the nodes.
+func planLines(explain string) string {
+	var lines []string
+
+	if i := strings.Index(explain, "plan:\n"); i >= 0 {
+		for _, l := range strings.Split(explain[i+len("plan:\n"):], "\n") {
+			if i = strings.Index(l, "  "); i >= 0 {
+				l = l[:i]
+			}
+
+			lines = append(lines, l)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func TestExecuteScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		out  [][]int64
+		r    = newCountingResolver()
+		file = filepath.Join(dir, "out.txt")
+	)
+
+	script := `# a script
+x = [INT a d]
+print [SUM x b]
+write "` + file + `" [DIF a x]
+print [LET y {7} [SUM x y e]]
+`
+
+	err = calc.ExecuteScript(script, func(v []int64) error {
+		out = append(out, v)
+		return nil
+	}, calc.WithResolver(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]int64{{1, 2, 3, 4, 5}, {1, 4, 5, 7, 9}}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("got %v, want %v", out, want)
+	}
+
+	if v, err := setfile.ReadFile(file); err != nil || !reflect.DeepEqual(v, []int64{2, 3, 6}) {
+		t.Errorf("got %v (%v), want %v", v, err, []int64{2, 3, 6})
+	}
+
+	for name, n := range r.reads {
+		if n != 1 {
+			t.Errorf("%s: got %v reads, want 1", name, n)
+		}
+	}
+
+	err = calc.ExecuteScript("x = a\nprint [SUM x z]\n", func([]int64) error { return nil },
+		calc.WithResolver(testSets))
+	if !errors.Is(err, calc.ErrNotFound) || !strings.HasPrefix(err.Error(), "line 2: ") {
+		t.Errorf("got %v, want %v at line 2", err, calc.ErrNotFound)
+	}
+}
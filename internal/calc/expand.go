@@ -0,0 +1,146 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/runningmaster/sc/internal/setfile"
+)
+
+// Expander is implemented by resolvers expanding an operand name to the
+// names of several sets, like a glob pattern or a directory to the names
+// of its files. Expand returns the names in the order they become operands,
+// an empty slice if the name stands for no sets, or nil if the name is not
+// to be expanded.
+type Expander interface {
+	Resolver
+	Expand(name string) ([]string, error)
+}
+
+// expand returns the names the name stands for if r supports expansion,
+// otherwise it returns the name itself.
+func expand(r Resolver, name string) ([]string, error) {
+	if er, ok := r.(Expander); ok {
+		names, err := er.Expand(name)
+		if err != nil || names != nil {
+			return names, err
+		}
+	}
+
+	return []string{name}, nil
+}
+
+// Expand expands glob patterns to the sorted names of the files matching
+// them and directories to the sorted names of the files in them.
+// Subdirectories are skipped. Patterns matching no files and directories
+// without files are not found, names of existing files and the standard
+// input are not expanded.
+func (FileResolver) Expand(name string) ([]string, error) {
+	if name == setfile.Stdin {
+		return nil, nil
+	}
+
+	fi, err := os.Stat(name)
+
+	switch {
+	case err == nil && fi.IsDir():
+		names, err := files(name)
+		if err == nil && len(names) == 0 {
+			err = fmt.Errorf("%w: no files in %s", ErrNotFound, name)
+		}
+
+		return names, err
+	case err == nil || !strings.ContainsAny(name, `*?[`):
+		return nil, nil
+	}
+
+	matches, err := filepath.Glob(name)
+	if err != nil {
+		return nil, fmt.Errorf("pattern %s: %w", name, err)
+	}
+
+	names := make([]string, 0, len(matches))
+
+	for _, m := range matches {
+		if fi, err := os.Stat(m); err == nil && fi.IsDir() {
+			continue
+		}
+
+		names = append(names, m)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%w: no files match %s", ErrNotFound, name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// files returns the sorted names of the files in the directory.
+func files(dir string) ([]string, error) {
+	list, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(list))
+
+	for _, fi := range list {
+		if !fi.IsDir() {
+			names = append(names, filepath.Join(dir, fi.Name()))
+		}
+	}
+
+	return names, nil
+}
+
+// Expand expands glob patterns and directories within the directory to
+// names relative to it.
+func (d DirResolver) Expand(name string) ([]string, error) {
+	names, err := d.FileResolver.Expand(d.path(name))
+	if err != nil || names == nil {
+		return names, err
+	}
+
+	for i, n := range names {
+		if names[i], err = filepath.Rel(d.Dir, n); err != nil {
+			return nil, err
+		}
+	}
+
+	return names, nil
+}
+
+// Expand expands the name with the first resolver that knows it.
+// Resolvers not implementing StatResolver end the search unless they
+// expand the name, as they may know it.
+func (m MultiResolver) Expand(name string) ([]string, error) {
+	var notFound error
+
+	for _, r := range m {
+		if er, ok := r.(Expander); ok {
+			names, err := er.Expand(name)
+			if errors.Is(err, ErrNotFound) {
+				notFound = err
+				continue
+			}
+
+			if err != nil || names != nil {
+				return names, err
+			}
+		}
+
+		if _, err := stat(r, name); !errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+	}
+
+	return nil, notFound
+}
@@ -0,0 +1,219 @@
+package calc
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/runningmaster/sc/internal/parser"
+	"github.com/runningmaster/sc/internal/sets"
+)
+
+// WithExplain makes Execute, ExecuteStream and ExecuteScript write a report
+// of the evaluation to w: the parsed expressions and the optimized plan
+// with the estimated and the actual numbers of values, the bytes read and
+// the time spent in every node. Times of nodes include times of their
+// operands, numbers of values of nodes evaluated several times are totals.
+// The report is written after a successful evaluation.
+func WithExplain(w io.Writer) Option {
+	return func(c *config) {
+		c.explain = w
+	}
+}
+
+// actual records the evaluation of a plan node.
+type actual struct {
+	evals   int           // number of evaluations
+	card    int64         // number of values of all evaluations
+	bytes   int64         // bytes read by operands evaluated in memory
+	time    time.Duration // time spent in evaluations
+	spills  int           // number of evaluations spilled to temporary files
+	sources []byteCounter // streams read by the node
+}
+
+// byteCounter is implemented by streams counting bytes they read.
+type byteCounter interface {
+	Bytes() int64
+}
+
+// observe returns the record of the node.
+func (e *evaluator) observe(p *plan) *actual {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	a, ok := e.actual[p]
+	if !ok {
+		a = &actual{}
+		e.actual[p] = a
+	}
+
+	return a
+}
+
+// timed returns the iterator recording the values and the time spent
+// in the iterator it of the node, or it if nothing is recorded.
+func (e *evaluator) timed(p *plan, it sets.Iterator) sets.Iterator {
+	if e.actual == nil {
+		return it
+	}
+
+	a := e.observe(p)
+	a.evals++
+
+	return &timedIterator{Iterator: it, a: a}
+}
+
+type timedIterator struct {
+	sets.Iterator
+	a *actual
+}
+
+func (t *timedIterator) Next() bool {
+	start := time.Now()
+	ok := t.Iterator.Next()
+	t.a.time += time.Since(start)
+
+	if ok {
+		t.a.card++
+	}
+
+	return ok
+}
+
+func (t *timedIterator) SeekGE(v int64) bool {
+	start := time.Now()
+	ok := sets.SeekGE(t.Iterator, v)
+	t.a.time += time.Since(start)
+
+	if ok {
+		t.a.card++
+	}
+
+	return ok
+}
+
+// explain writes the report of the evaluation. Heads name the parsed
+// expressions and the plans of a script, they are nil for an expression.
+func (e *evaluator) explain(w io.Writer, asts []*parser.Node, astHeads []string,
+	plans []*plan, planHeads []string) error {
+	var b strings.Builder
+
+	b.WriteString("parsed:\n")
+
+	for i, n := range asts {
+		if astHeads != nil {
+			b.WriteString(astHeads[i] + "\n")
+		}
+
+		b.WriteString(n.String() + "\n")
+	}
+
+	b.WriteString("plan:\n")
+
+	seen := map[*plan]bool{}
+
+	for i, p := range plans {
+		if planHeads != nil {
+			b.WriteString(planHeads[i] + "\n")
+		}
+
+		e.render(&b, p, "", "", seen)
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err
+}
+
+// render writes the line of the node prefixed by first and the lines of its
+// operands prefixed by rest. Nodes seen before are not repeated.
+func (e *evaluator) render(b *strings.Builder, p *plan, first, rest string, seen map[*plan]bool) {
+	if seen[p] {
+		b.WriteString(first + label(p) + " (see above)\n")
+		return
+	}
+
+	seen[p] = true
+
+	b.WriteString(first + label(p) + "  " + e.describe(p) + "\n")
+
+	for i, a := range p.args {
+		if i == len(p.args)-1 {
+			e.render(b, a, rest+"└─ ", rest+"   ", seen)
+		} else {
+			e.render(b, a, rest+"├─ ", rest+"│  ", seen)
+		}
+	}
+}
+
+// label returns the operator or the source of the node.
+func label(p *plan) string {
+	switch {
+	case p.op == parser.TokenIdentifier:
+		return strconv.Quote(p.name)
+	case p.op == parser.TokenRange && p.lo == p.hi:
+		return strconv.FormatInt(p.lo, 10)
+	case p.op == parser.TokenRange:
+		return strconv.FormatInt(p.lo, 10) + ".." + strconv.FormatInt(p.hi, 10)
+	case p.op == parser.TokenSUM && len(p.args) == 0:
+		return "{}"
+	case p.op == parser.TokenATLEAST, p.op == parser.TokenATMOST:
+		return p.op.String() + " " + strconv.Itoa(p.k)
+	}
+
+	return p.op.String()
+}
+
+// describe returns the estimated and the actual statistics of the node.
+func (e *evaluator) describe(p *plan) string {
+	est := "?"
+
+	switch {
+	case p.est.Exact:
+		est = strconv.FormatInt(p.est.Card, 10)
+	case p.est.Card >= 0:
+		est = "~" + strconv.FormatInt(p.est.Card, 10)
+	}
+
+	a, ok := e.actual[p]
+	if !ok || a.evals == 0 {
+		return fmt.Sprintf("est=%s not evaluated", est)
+	}
+
+	s := fmt.Sprintf("est=%s card=%d bytes=%d time=%v", est, a.card, e.bytes(p, map[*plan]bool{}), a.time)
+	if a.evals > 1 {
+		s += fmt.Sprintf(" evals=%d", a.evals)
+	}
+
+	if a.spills > 0 {
+		s += fmt.Sprintf(" spills=%d", a.spills)
+	}
+
+	return s
+}
+
+// bytes returns the bytes read by the operands of the node.
+func (e *evaluator) bytes(p *plan, seen map[*plan]bool) int64 {
+	if seen[p] {
+		return 0
+	}
+
+	seen[p] = true
+
+	var n int64
+
+	if a, ok := e.actual[p]; ok {
+		n = a.bytes
+		for _, s := range a.sources {
+			n += s.Bytes()
+		}
+	}
+
+	for _, v := range p.args {
+		n += e.bytes(v, seen)
+	}
+
+	return n
+}
@@ -0,0 +1,327 @@
+package calc
+
+import (
+	"math"
+	"sort"
+
+	"github.com/runningmaster/sc/internal/parser"
+)
+
+// optimizer rewrites plans to cheaper equal plans using statistics of
+// operands. The rewrites are:
+//
+//   - nested SUM, INT and XOR operands used once are flattened into their
+//     parents, as are DIF minuends and SUM subtrahends of DIF;
+//   - operands known to be empty are dropped. INT of operands known to be
+//     empty or to have no common values is empty. Subtrahends of DIF
+//     disjoint from the minuend are dropped;
+//   - DIF of a SUM is pushed below the SUM if some of its operands are
+//     disjoint from some of the subtrahends;
+//   - operands of commutative operators and subtrahends of DIF are ordered
+//     by their estimated numbers of values, smallest first.
+type optimizer struct {
+	r    Resolver
+	pl   *planner
+	done map[*plan]*plan
+}
+
+func newOptimizer(r Resolver) *optimizer {
+	return &optimizer{r: r, pl: newPlanner(nil), done: map[*plan]*plan{}}
+}
+
+// optimize returns the optimized plans of the roots with counted uses.
+// Operands are reported missing even if the optimized plans do not need them.
+func optimize(r Resolver, roots ...*plan) ([]*plan, error) {
+	count(roots...)
+
+	var (
+		o   = newOptimizer(r)
+		out = make([]*plan, len(roots))
+		err error
+	)
+
+	for i, p := range roots {
+		if out[i], err = o.optimize(p); err != nil {
+			return nil, err
+		}
+	}
+
+	count(out...)
+
+	return out, nil
+}
+
+// optimize returns the optimized plan of p. The uses of the nodes of p
+// must be counted, the uses of the optimized plan are not.
+func (o *optimizer) optimize(p *plan) (*plan, error) {
+	if q, ok := o.done[p]; ok {
+		return q, nil
+	}
+
+	var q *plan
+
+	switch p.op {
+	case parser.TokenIdentifier:
+		st, err := stat(o.r, p.name)
+		if err != nil {
+			return nil, err
+		}
+
+		q = o.pl.intern(&plan{op: p.op, name: p.name, est: st})
+	case parser.TokenRange:
+		card := uint64(p.hi-p.lo) + 1
+		if card == 0 || card > math.MaxInt64 {
+			card = math.MaxInt64
+		}
+
+		q = o.pl.intern(&plan{op: p.op, lo: p.lo, hi: p.hi, est: Stats{
+			Card: int64(card), Exact: true, Min: p.lo, Max: p.hi, Bounded: true, Bytes: -1,
+		}})
+	default:
+		args := make([]*plan, 0, len(p.args))
+
+		for i, a := range p.args {
+			v, err := o.optimize(a)
+			if err != nil {
+				return nil, err
+			}
+
+			if a.refs == 1 && flattens(p.op, i, len(p.args), v) {
+				args = append(args, v.args...)
+			} else {
+				args = append(args, v)
+			}
+		}
+
+		q = o.rewrite(p.op, p.k, args)
+	}
+
+	o.done[p] = q
+
+	return q, nil
+}
+
+// flattens reports whether the i-th of n operands v of the operator op
+// can be replaced by the operands of v.
+func flattens(op parser.TokenType, i, n int, v *plan) bool {
+	switch op {
+	case parser.TokenSUM, parser.TokenXOR:
+		return v.op == op
+	case parser.TokenINT:
+		return v.op == op && len(v.args) > 1 && n > 1 // INT of a single set is empty
+	case parser.TokenDIF:
+		return i == 0 && v.op == parser.TokenDIF || i > 0 && v.op == parser.TokenSUM
+	}
+
+	return false
+}
+
+// rewrite returns the optimized plan of the operator applied to args.
+func (o *optimizer) rewrite(op parser.TokenType, k int, args []*plan) *plan {
+	switch op {
+	case parser.TokenINT:
+		if len(args) < 2 {
+			return o.empty()
+		}
+
+		st := args[0].est
+		for _, a := range args[1:] {
+			if st.disjoint(a.est) {
+				return o.empty()
+			}
+
+			st.Min, st.Max, st.Bounded = intersect(st, a.est)
+		}
+	case parser.TokenDIF:
+		first, sub := args[0], nonEmpty(args[1:])
+		if first.est.empty() {
+			return o.empty()
+		}
+
+		sub = overlapping(first, sub)
+		if len(sub) == 0 {
+			return first
+		}
+
+		if q := o.pushDif(first, sub); q != nil {
+			return q
+		}
+
+		args = append([]*plan{first}, sub...)
+	default:
+		args = nonEmpty(args)
+		if len(args) == 1 && (op == parser.TokenSUM || op == parser.TokenXOR || op == parser.TokenONE) {
+			return args[0]
+		}
+	}
+
+	if op == parser.TokenDIF {
+		bySize(args[1:])
+	} else {
+		bySize(args)
+	}
+
+	return o.node(op, k, args)
+}
+
+// pushDif returns the SUM of DIF of the operands of first if some of them
+// are disjoint from some of the subtrahends, otherwise pushDif returns nil.
+func (o *optimizer) pushDif(first *plan, sub []*plan) *plan {
+	if first.op != parser.TokenSUM {
+		return nil
+	}
+
+	var pays bool
+
+	for _, a := range first.args {
+		if len(overlapping(a, sub)) < len(sub) {
+			pays = true
+			break
+		}
+	}
+
+	if !pays {
+		return nil
+	}
+
+	args := make([]*plan, 0, len(first.args))
+	for _, a := range first.args {
+		args = append(args, o.rewrite(parser.TokenDIF, 0, append([]*plan{a}, sub...)))
+	}
+
+	return o.rewrite(parser.TokenSUM, 0, args)
+}
+
+// empty returns the plan of the empty set.
+func (o *optimizer) empty() *plan {
+	return o.node(parser.TokenSUM, 0, nil)
+}
+
+// node returns the plan node of the operator applied to args.
+func (o *optimizer) node(op parser.TokenType, k int, args []*plan) *plan {
+	p := &plan{op: op, k: k, args: args}
+	p.est = estimate(p)
+
+	return o.pl.intern(p)
+}
+
+// nonEmpty returns the plans not known to be empty.
+func nonEmpty(args []*plan) []*plan {
+	out := make([]*plan, 0, len(args))
+
+	for _, a := range args {
+		if !a.est.empty() {
+			out = append(out, a)
+		}
+	}
+
+	return out
+}
+
+// overlapping returns the plans not known to be disjoint from p.
+func overlapping(p *plan, args []*plan) []*plan {
+	out := make([]*plan, 0, len(args))
+
+	for _, a := range args {
+		if !p.est.disjoint(a.est) {
+			out = append(out, a)
+		}
+	}
+
+	return out
+}
+
+// bySize orders the plans by their estimated numbers of values, smallest
+// first. Plans of unknown sizes go last in their original order.
+func bySize(args []*plan) {
+	sort.SliceStable(args, func(i, j int) bool {
+		a, b := args[i].est.Card, args[j].est.Card
+
+		return a >= 0 && (b < 0 || a < b)
+	})
+}
+
+// estimate returns the statistics of the operator node by the statistics
+// of its operands.
+func estimate(p *plan) Stats {
+	if len(p.args) == 0 {
+		return Stats{Card: 0, Exact: true, Bytes: 0}
+	}
+
+	st := p.args[0].est
+	st.Exact = false
+
+	for _, a := range p.args[1:] {
+		switch p.op {
+		case parser.TokenINT:
+			st.Card = minCard(st.Card, a.est.Card)
+			st.Min, st.Max, st.Bounded = intersect(st, a.est)
+		case parser.TokenDIF:
+		default:
+			st.Card = sumCard(st.Card, a.est.Card)
+			st.Min, st.Max, st.Bounded = union(st, a.est)
+		}
+
+		st.Bytes = sumCard(st.Bytes, a.est.Bytes)
+	}
+
+	return st
+}
+
+func minCard(a, b int64) int64 {
+	if a < 0 || b >= 0 && b < a {
+		return b
+	}
+
+	return a
+}
+
+func sumCard(a, b int64) int64 {
+	switch {
+	case a < 0 || b < 0:
+		return -1
+	case a > math.MaxInt64-b:
+		return math.MaxInt64
+	}
+
+	return a + b
+}
+
+// intersect returns the bounds of the common values of the sets.
+func intersect(s, t Stats) (lo, hi int64, ok bool) {
+	switch {
+	case !s.Bounded:
+		return t.Min, t.Max, t.Bounded
+	case !t.Bounded:
+		return s.Min, s.Max, true
+	}
+
+	lo, hi = s.Min, s.Max
+	if t.Min > lo {
+		lo = t.Min
+	}
+
+	if t.Max < hi {
+		hi = t.Max
+	}
+
+	return lo, hi, true
+}
+
+// union returns the bounds of the values of both sets.
+func union(s, t Stats) (lo, hi int64, ok bool) {
+	if !s.Bounded || !t.Bounded {
+		return 0, 0, false
+	}
+
+	lo, hi = s.Min, s.Max
+	if t.Min < lo {
+		lo = t.Min
+	}
+
+	if t.Max > hi {
+		hi = t.Max
+	}
+
+	return lo, hi, true
+}
@@ -0,0 +1,231 @@
+package calc
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/runningmaster/sc/internal/parser"
+	"github.com/runningmaster/sc/internal/setfile"
+)
+
+// plan is a node of the evaluation plan. Equal subtrees of expressions share
+// a plan node, so every unique subtree and every operand is evaluated once.
+type plan struct {
+	op     parser.TokenType // operator, TokenIdentifier or TokenRange
+	k      int              // threshold of ATLEAST and ATMOST
+	name   string           // name of TokenIdentifier
+	lo, hi int64            // bounds of TokenRange
+	args   []*plan          // operands in the order of the source
+	key    string           // canonical form of the subtree
+	refs   int              // number of uses of the node
+	est    Stats            // estimated statistics of the value
+}
+
+// planner makes plans of expressions. Plans made by the same planner share
+// equal subtrees. Operand names are expanded by r if it is not nil.
+type planner struct {
+	r     Resolver
+	nodes map[string]*plan
+	stdin bool // whether the standard input is an operand
+}
+
+func newPlanner(r Resolver) *planner {
+	return &planner{r: r, nodes: map[string]*plan{}}
+}
+
+// scope binds names of LET expressions and assignments to their plans.
+type scope struct {
+	name string
+	p    *plan
+	prev *scope
+}
+
+// lookup returns the plan of the innermost binding of the name.
+func (s *scope) lookup(name string) (*plan, error) {
+	for ; s != nil; s = s.prev {
+		if s.name == name {
+			return s.p, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unbound name %s", name)
+}
+
+// build makes the plan of the node. Names bound by LET are replaced
+// by the plans of their values. An operand name expanded to several sets
+// stands for their union unless it is an operand of an expression.
+func (pl *planner) build(n *parser.Node, s *scope) (*plan, error) {
+	switch n.Type() {
+	case parser.TokenIdentifier:
+		args, err := pl.operands(n.Vals()[0])
+		if err != nil {
+			return nil, err
+		}
+
+		if len(args) == 1 {
+			return args[0], nil
+		}
+
+		return pl.intern(&plan{op: parser.TokenSUM, args: args}), nil
+	case parser.TokenVar:
+		return s.lookup(n.Vals()[0])
+	case parser.TokenNumber, parser.TokenRange:
+		lo, hi := bounds(n)
+		return pl.intern(&plan{op: parser.TokenRange, lo: lo, hi: hi}), nil
+	case parser.TokenLET:
+		v, err := pl.build(n.Next()[0], s)
+		if err != nil {
+			return nil, err
+		}
+
+		return pl.build(n.Next()[1], &scope{name: n.Vals()[0], p: v, prev: s})
+	}
+
+	p := &plan{op: n.Type(), k: n.Threshold(), args: make([]*plan, 0, len(n.Next()))}
+	if p.op == parser.TokenSet {
+		p.op = parser.TokenSUM
+	}
+
+	for _, v := range n.Next() {
+		if v.Type() == parser.TokenIdentifier {
+			args, err := pl.operands(v.Vals()[0])
+			if err != nil {
+				return nil, err
+			}
+
+			p.args = append(p.args, args...)
+
+			continue
+		}
+
+		a, err := pl.build(v, s)
+		if err != nil {
+			return nil, err
+		}
+
+		p.args = append(p.args, a)
+	}
+
+	return pl.intern(p), nil
+}
+
+// operands returns the leaves of the sets the operand name stands for in
+// the order of the expansion. A name expanded to no sets stands for
+// the empty set.
+func (pl *planner) operands(name string) ([]*plan, error) {
+	names := []string{name}
+
+	if pl.r != nil {
+		var err error
+		if names, err = expand(pl.r, name); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(names) == 0 {
+		return []*plan{pl.intern(&plan{op: parser.TokenSUM})}, nil
+	}
+
+	args := make([]*plan, len(names))
+
+	for i, name := range names {
+		if name == setfile.Stdin && pl.stdin {
+			return nil, fmt.Errorf("standard input %s is an operand more than once", name)
+		}
+
+		pl.stdin = pl.stdin || name == setfile.Stdin
+		args[i] = pl.intern(&plan{op: parser.TokenIdentifier, name: name})
+	}
+
+	return args, nil
+}
+
+// intern returns the plan node equal to p, adding p if there is none.
+func (pl *planner) intern(p *plan) *plan {
+	p.key = canonical(p)
+	if q, ok := pl.nodes[p.key]; ok {
+		return q
+	}
+
+	pl.nodes[p.key] = p
+
+	return p
+}
+
+// canonical returns the canonical form of the node. Operands of
+// commutative operators and the subtrahends of DIF are sorted.
+func canonical(p *plan) string {
+	switch p.op {
+	case parser.TokenIdentifier:
+		return strconv.Quote(p.name)
+	case parser.TokenRange:
+		return strconv.FormatInt(p.lo, 10) + ".." + strconv.FormatInt(p.hi, 10)
+	}
+
+	keys := make([]string, len(p.args))
+	for i, a := range p.args {
+		keys[i] = a.key
+	}
+
+	if p.op == parser.TokenDIF {
+		sort.Strings(keys[1:])
+	} else {
+		sort.Strings(keys)
+	}
+
+	op := p.op.String()
+	if p.op == parser.TokenATLEAST || p.op == parser.TokenATMOST {
+		op += " " + strconv.Itoa(p.k)
+	}
+
+	return "[" + op + " " + strings.Join(keys, " ") + "]"
+}
+
+// count counts the uses of the nodes of the plans. Roots are used once
+// each, other nodes once by every operator having them as operands.
+func count(roots ...*plan) {
+	var visit func(p *plan)
+
+	visit = func(p *plan) {
+		p.refs++
+		if p.refs > 1 {
+			return
+		}
+
+		for _, a := range p.args {
+			visit(a)
+		}
+	}
+
+	for _, p := range roots {
+		visit(p)
+	}
+}
+
+// size returns the number of distinct nodes of the plans.
+func size(roots []*plan) int {
+	var (
+		seen  = map[*plan]bool{}
+		visit func(p *plan)
+	)
+
+	visit = func(p *plan) {
+		if seen[p] {
+			return
+		}
+
+		seen[p] = true
+
+		for _, a := range p.args {
+			visit(a)
+		}
+	}
+
+	for _, p := range roots {
+		visit(p)
+	}
+
+	return len(seen)
+}
@@ -0,0 +1,130 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/runningmaster/sc/internal/sets"
+)
+
+// Progress tells how far an evaluation got.
+type Progress struct {
+	Nodes     int           // number of nodes of the plan
+	Evaluated int           // number of nodes evaluated completely
+	Output    int64         // number of values of results passed on
+	Elapsed   time.Duration // time since the start of the evaluation
+}
+
+// InterruptedError is returned when the context of an evaluation is done
+// before the evaluation completes.
+type InterruptedError struct {
+	Err      error // error of the context
+	Progress Progress
+}
+
+func (e *InterruptedError) Error() string {
+	p := e.Progress
+
+	return fmt.Sprintf("%v after %v: %d of %d nodes evaluated, %d values passed on",
+		e.Err, p.Elapsed.Round(time.Millisecond), p.Evaluated, p.Nodes, p.Output)
+}
+
+func (e *InterruptedError) Unwrap() error {
+	return e.Err
+}
+
+// interrupted returns *InterruptedError if the evaluation failed because
+// ctx is done, otherwise it returns err.
+func (e *evaluator) interrupted(ctx context.Context, err error) error {
+	if ctx.Err() == nil || !errors.Is(err, ctx.Err()) {
+		return err
+	}
+
+	return &InterruptedError{Err: ctx.Err(), Progress: Progress{
+		Nodes:     e.nodes,
+		Evaluated: int(atomic.LoadInt64(&e.evaluated)),
+		Output:    atomic.LoadInt64(&e.output),
+		Elapsed:   time.Since(e.start),
+	}}
+}
+
+// checkEvery is the number of values read between checks of the context.
+const checkEvery = 1 << 12
+
+// ctxIterator stops iterating when the context is done. It counts
+// the iterators exhausted as evaluated nodes.
+type ctxIterator struct {
+	sets.Iterator
+	ctx  context.Context
+	e    *evaluator
+	n    int
+	err  error
+	done bool
+}
+
+// checked returns the iterator stopping when ctx is done, or it if ctx
+// is never done.
+func (e *evaluator) checked(ctx context.Context, it sets.Iterator) sets.Iterator {
+	if ctx.Done() == nil {
+		return it
+	}
+
+	return &ctxIterator{Iterator: it, ctx: ctx, e: e}
+}
+
+func (c *ctxIterator) Next() bool {
+	if c.err != nil || c.done {
+		return false
+	}
+
+	if c.n++; c.n%checkEvery == 0 {
+		if c.err = c.ctx.Err(); c.err != nil {
+			return false
+		}
+	}
+
+	if c.Iterator.Next() {
+		return true
+	}
+
+	c.done = true
+
+	if c.Iterator.Err() == nil {
+		atomic.AddInt64(&c.e.evaluated, 1)
+	}
+
+	return false
+}
+
+func (c *ctxIterator) SeekGE(v int64) bool {
+	if c.err != nil || c.done {
+		return false
+	}
+
+	if c.err = c.ctx.Err(); c.err != nil {
+		return false
+	}
+
+	if sets.SeekGE(c.Iterator, v) {
+		return true
+	}
+
+	c.done = true
+
+	if c.Iterator.Err() == nil {
+		atomic.AddInt64(&c.e.evaluated, 1)
+	}
+
+	return false
+}
+
+func (c *ctxIterator) Err() error {
+	if c.err != nil {
+		return c.err
+	}
+
+	return c.Iterator.Err()
+}
@@ -0,0 +1,203 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/runningmaster/sc/internal/setfile"
+	"github.com/runningmaster/sc/internal/sortutil"
+)
+
+// ErrNotFound is returned by a Resolver that knows no set of the given name.
+var ErrNotFound = errors.New("set not found")
+
+// Resolver resolves operand names of an expression to sets.
+// The returned sets must be sorted in ascending order without duplicates.
+// A Resolver must return an error wrapping ErrNotFound if it knows no
+// set of the given name.
+type Resolver interface {
+	Resolve(name string) ([]int64, error)
+}
+
+// ContextResolver is implemented by resolvers able to stop resolving
+// a set when the context is done.
+type ContextResolver interface {
+	Resolver
+	ResolveContext(ctx context.Context, name string) ([]int64, error)
+}
+
+// resolve resolves the name with ctx if r supports it.
+func resolve(ctx context.Context, r Resolver, name string) ([]int64, error) {
+	if cr, ok := r.(ContextResolver); ok {
+		return cr.ResolveContext(ctx, name)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return r.Resolve(name)
+}
+
+// ResolverFunc is an adapter to allow the use of ordinary functions as resolvers.
+type ResolverFunc func(name string) ([]int64, error)
+
+// Resolve calls f(name).
+func (f ResolverFunc) Resolve(name string) ([]int64, error) {
+	return f(name)
+}
+
+// FileResolver resolves names as paths of files containing integers,
+// one integer in a line. Lines not holding integers of int64 are errors.
+// Values must be sorted in ascending order, repeated values are skipped.
+type FileResolver struct {
+	// Strict makes Resolve reject files not sorted in ascending order with
+	// an error reporting the first line out of order. Otherwise Resolve
+	// sorts the values of such files. Strict does not affect Open, streams
+	// of files not sorted fail at the first line out of order in any case.
+	Strict bool
+	// Warn, if not nil, is called with the error of the first line out of
+	// order of files sorted by Resolve.
+	Warn func(err error)
+}
+
+// Resolve reads the named file and returns its values sorted and deduplicated.
+func (r FileResolver) Resolve(name string) ([]int64, error) {
+	return r.ResolveContext(context.Background(), name)
+}
+
+// ResolveContext is like Resolve but stops reading when ctx is done.
+func (r FileResolver) ResolveContext(ctx context.Context, name string) ([]int64, error) {
+	f, err := setfile.Open(name)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		v        []int64
+		unsorted error
+	)
+
+	if h := f.Header(); h != nil {
+		v = make([]int64, 0, capacity(h.Count))
+	}
+
+	for {
+		if len(v)%checkEvery == 0 {
+			if err = ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		n, err := f.Read()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if unsorted == nil && len(v) > 0 && n < v[len(v)-1] {
+			unsorted = &setfile.Error{Name: name, Line: f.Line(), Err: setfile.ErrNotSorted}
+			if r.Strict {
+				return nil, unsorted
+			}
+		}
+
+		v = append(v, n)
+	}
+
+	if unsorted == nil {
+		return sortutil.DeDupInt64(v), nil
+	}
+
+	if r.Warn != nil {
+		r.Warn(unsorted)
+	}
+
+	return sortutil.DeDupInt64(sortutil.SortInt64(v)), nil
+}
+
+// maxCapacity is the greatest number of values allocated in advance for
+// sets read from files, as counts in headers of corrupt files are wrong.
+const maxCapacity = 1 << 24
+
+// capacity returns the number of values to allocate for a set of n values.
+func capacity(n int64) int64 {
+	if n > maxCapacity {
+		return maxCapacity
+	}
+
+	return n
+}
+
+// DirResolver resolves names as paths of files within the directory.
+// Names can not refer to files outside of the directory.
+type DirResolver struct {
+	// Dir is the directory of the files.
+	Dir string
+	// FileResolver reads the files, its options apply to them.
+	FileResolver
+}
+
+// path returns the path of the named file of the directory.
+func (d DirResolver) path(name string) string {
+	return filepath.Join(d.Dir, filepath.Clean("/"+name))
+}
+
+// Resolve reads the named file of the directory.
+func (d DirResolver) Resolve(name string) ([]int64, error) {
+	return d.ResolveContext(context.Background(), name)
+}
+
+// ResolveContext is like Resolve but stops reading when ctx is done.
+func (d DirResolver) ResolveContext(ctx context.Context, name string) ([]int64, error) {
+	return d.FileResolver.ResolveContext(ctx, d.path(name))
+}
+
+// MapResolver resolves names from the map. The map values must be sorted
+// in ascending order without duplicates.
+type MapResolver map[string][]int64
+
+// Resolve returns the set of the given name.
+func (m MapResolver) Resolve(name string) ([]int64, error) {
+	v, ok := m[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	return v, nil
+}
+
+// MultiResolver resolves names with the first resolver that knows them.
+// Errors other than ErrNotFound are returned immediately.
+type MultiResolver []Resolver
+
+// Resolve tries the resolvers in order.
+func (m MultiResolver) Resolve(name string) ([]int64, error) {
+	return m.ResolveContext(context.Background(), name)
+}
+
+// ResolveContext is like Resolve but passes ctx to resolvers supporting it.
+func (m MultiResolver) ResolveContext(ctx context.Context, name string) ([]int64, error) {
+	for _, r := range m {
+		v, err := resolve(ctx, r, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+
+		return v, err
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
@@ -0,0 +1,181 @@
+package calc_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/runningmaster/sc/internal/calc"
+	"github.com/runningmaster/sc/internal/setfile"
+	"github.com/runningmaster/sc/internal/testutil"
+)
+
+var ttFiles = []struct { //nolint: gochecknoglobals
+	in  string
+	out []int64
+}{
+	{`[SUM testdata/a.txt testdata/b.txt]`, []int64{1, 3, 4, 5, 6, 9}},
+	{`[SUM testdata/a.txt testdata/c.txt]`, []int64{-2, 0, 1, 3, 5, 9}},
+	{`[INT testdata/a.txt testdata/b.txt]`, []int64{3, 5}},
+	{`[DIF testdata/a.txt testdata/b.txt testdata/c.txt]`, []int64{1}},
+	{`[INT testdata/b.txt [SUM testdata/c.txt testdata/a.txt]]`, []int64{3, 5}},
+}
+
+func TestExecuteFiles(t *testing.T) {
+	for i, tt := range ttFiles {
+		out, err := calc.Execute(tt.in)
+		if err != nil || !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: got %v (%v), want %v", i, out, err, tt.out)
+		}
+	}
+
+	_, err := calc.Execute(`[SUM testdata/a.txt testdata/missing.txt]`)
+	if !errors.Is(err, calc.ErrNotFound) {
+		t.Errorf("got %v, want %v", err, calc.ErrNotFound)
+	}
+
+	want := "set not found: stat testdata/missing.txt: no such file or directory"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %q, want %q", err, want)
+	}
+}
+
+func TestDirResolver(t *testing.T) {
+	root, cleanup := testutil.TempDir(t)
+	defer cleanup()
+
+	dir := filepath.Join(root, "d")
+
+	for name, data := range map[string]string{
+		"x.txt":       "9\n",
+		"d/a.txt":     "1\n2\n",
+		"d/sub/b.txt": "3\n",
+		"d/c.txt":     "2\n1\n",
+	} {
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0o700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(name, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, tt := range []struct {
+		name   string
+		strict bool
+		out    []int64
+		err    error
+		warn   bool
+	}{
+		{"a.txt", false, []int64{1, 2}, nil, false},
+		{"sub/b.txt", false, []int64{3}, nil, false},
+		{"sub/../a.txt", false, []int64{1, 2}, nil, false},
+		{"/a.txt", false, []int64{1, 2}, nil, false},
+		{"../x.txt", false, nil, calc.ErrNotFound, false},
+		{"sub/../../x.txt", false, nil, calc.ErrNotFound, false},
+		{filepath.Join(root, "x.txt"), false, nil, calc.ErrNotFound, false},
+		{"c.txt", false, []int64{1, 2}, nil, true},
+		{"c.txt", true, nil, setfile.ErrNotSorted, false},
+	} {
+		var warn error
+
+		r := calc.DirResolver{Dir: dir, FileResolver: calc.FileResolver{
+			Strict: tt.strict, Warn: func(err error) { warn = err },
+		}}
+
+		out, err := r.Resolve(tt.name)
+		if !errors.Is(err, tt.err) || tt.err == nil && err != nil || !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: got %v (%v), want %v (%v)", i, out, err, tt.out, tt.err)
+		}
+
+		if (warn != nil) != tt.warn {
+			t.Errorf("pos %v: got warning %v, want %v", i, warn, tt.warn)
+		}
+	}
+}
+
+func TestMultiResolver(t *testing.T) {
+	broken := errors.New("broken")
+	r := calc.MultiResolver{
+		calc.MapResolver{"a": {1}},
+		calc.ResolverFunc(func(name string) ([]int64, error) {
+			if name == "d" {
+				return nil, broken
+			}
+
+			return nil, fmt.Errorf("%w: %s", calc.ErrNotFound, name)
+		}),
+		calc.MapResolver{"a": {2}, "b": {3}, "d": {4}},
+	}
+
+	for i, tt := range []struct {
+		name string
+		out  []int64
+		err  error
+	}{
+		{"a", []int64{1}, nil},
+		{"b", []int64{3}, nil},
+		{"c", nil, calc.ErrNotFound},
+		{"d", nil, broken},
+	} {
+		out, err := r.Resolve(tt.name)
+		if !errors.Is(err, tt.err) || tt.err == nil && err != nil || !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: got %v (%v), want %v (%v)", i, out, err, tt.out, tt.err)
+		}
+	}
+}
+
+// contextResolver resolves every name to the error of the context.
+type contextResolver struct{}
+
+func (contextResolver) Resolve(name string) ([]int64, error) {
+	return nil, nil
+}
+
+func (contextResolver) ResolveContext(ctx context.Context, name string) ([]int64, error) {
+	return nil, ctx.Err()
+}
+
+func TestMultiResolverOpenContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	r := calc.MultiResolver{calc.MapResolver{}, contextResolver{}}
+
+	if _, err := r.OpenContext(ctx, "a"); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+
+	err := calc.ExecuteStreamContext(ctx, `[SUM a]`, func(int64) error { return nil }, calc.WithResolver(r))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("stream: got %v, want %v", err, context.Canceled)
+	}
+
+	s, err := r.Open("a")
+	if err != nil || s.Next() {
+		t.Errorf("got %v, want an empty stream", err)
+	}
+}
+
+func TestResolverFunc(t *testing.T) {
+	r := calc.ResolverFunc(func(name string) ([]int64, error) {
+		return []int64{int64(len(name))}, nil
+	})
+
+	out, err := r.Resolve("abc")
+	if want := []int64{3}; err != nil || !reflect.DeepEqual(out, want) {
+		t.Errorf("got %v (%v), want %v", out, err, want)
+	}
+
+	out, err = calc.Execute(`[SUM ab abc]`, calc.WithResolver(r))
+	if want := []int64{2, 3}; err != nil || !reflect.DeepEqual(out, want) {
+		t.Errorf("got %v (%v), want %v", out, err, want)
+	}
+}
@@ -0,0 +1,164 @@
+package calc
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/runningmaster/sc/internal/parser"
+	"github.com/runningmaster/sc/internal/setfile"
+)
+
+// ExecuteScript runs the statements of the script in order. The results of
+// print statements are passed to fn, write statements write their results to
+// set files. Equal subexpressions and operands of all statements are
+// evaluated once in a run, so statements sharing input files do not read
+// them again.
+func ExecuteScript(script string, fn func(v []int64) error, opts ...Option) error {
+	return ExecuteScriptContext(context.Background(), script, fn, opts...)
+}
+
+// ExecuteScriptContext is like ExecuteScript but stops the run when ctx
+// is done returning *InterruptedError. Statements completed before stay done.
+func ExecuteScriptContext(ctx context.Context, script string, fn func(v []int64) error, opts ...Option) error {
+	c := newConfig(opts)
+
+	st, err := parser.ParseScript(script)
+	if err != nil {
+		return err
+	}
+
+	var (
+		pl    = newPlanner(c.resolver)
+		s     *scope
+		roots []*plan
+		lines []int // lines of the statements of roots
+	)
+
+	for _, v := range st {
+		p, err := pl.build(v.Expr, s)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", v.Line, err)
+		}
+
+		if v.Type == parser.StatementAssign {
+			s = &scope{name: v.Name, p: p, prev: s}
+		} else {
+			roots = append(roots, p)
+			lines = append(lines, v.Line)
+		}
+	}
+
+	// roots are optimized one by one to report the lines of missing operands.
+	o := newOptimizer(c.resolver)
+	count(roots...)
+
+	for i, p := range roots {
+		if roots[i], err = o.optimize(p); err != nil {
+			return fmt.Errorf("line %d: %w", lines[i], err)
+		}
+	}
+
+	count(roots...)
+
+	e := newEvaluator(c, roots)
+	defer e.cleanup()
+
+	var (
+		asts                = make([]*parser.Node, 0, len(st))
+		astHeads, planHeads []string
+		i                   int
+	)
+
+	for _, v := range st {
+		asts = append(asts, v.Expr)
+		astHeads = append(astHeads, head(v))
+
+		if v.Type == parser.StatementAssign {
+			continue
+		}
+
+		planHeads = append(planHeads, head(v))
+
+		res, err := e.eval(ctx, roots[i])
+		i++
+
+		if err == nil {
+			err = e.run(v, res, fn)
+			e.release(res)
+		}
+
+		if err != nil {
+			return fmt.Errorf("line %d: %w", v.Line, e.interrupted(ctx, err))
+		}
+
+		e.output += res.n
+	}
+
+	if c.explain == nil {
+		return nil
+	}
+
+	return e.explain(c.explain, asts, astHeads, roots, planHeads)
+}
+
+// run passes the result of the print statement to fn or writes the result
+// of the write statement to its file. Spilled results are written without
+// reading them into memory.
+func (e *evaluator) run(st *parser.Statement, s *set, fn func(v []int64) error) error {
+	if st.Type == parser.StatementPrint || s.file == "" {
+		v, err := e.values(s)
+		if err != nil {
+			return err
+		}
+
+		if st.Type == parser.StatementPrint {
+			return fn(v)
+		}
+
+		return setfile.WriteFile(st.Name, v)
+	}
+
+	r, err := e.read(s)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := os.Create(st.Name)
+	if err != nil {
+		return err
+	}
+
+	w := setfile.NewWriter(f)
+
+	for r.Next() && err == nil {
+		err = w.Write(r.Value())
+	}
+
+	if err == nil {
+		err = r.Err()
+	}
+
+	if err == nil {
+		err = w.Flush()
+	}
+
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// head returns the line of the statement preceding its expression in reports.
+func head(st *parser.Statement) string {
+	switch st.Type {
+	case parser.StatementAssign:
+		return fmt.Sprintf("line %d: %s =", st.Line, st.Name)
+	case parser.StatementPrint:
+		return fmt.Sprintf("line %d: print", st.Line)
+	}
+
+	return fmt.Sprintf("line %d: write %q", st.Line, st.Name)
+}
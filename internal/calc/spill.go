@@ -0,0 +1,335 @@
+package calc
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+
+	"github.com/runningmaster/sc/internal/sets"
+)
+
+// WithMemoryLimit limits the memory held by the values of intermediate
+// results to about n bytes. Results not fitting the limit are written to
+// temporary files in a compact encoding and read back while merged into
+// their parents. The files are removed when the evaluation ends. n of 0
+// means no limit.
+func WithMemoryLimit(n int64) Option {
+	return func(c *config) {
+		c.limit = n
+	}
+}
+
+// valueSize is the memory held by a value of a set.
+const valueSize = 8
+
+// set is the value of a node kept in memory or spilled to a temporary file.
+type set struct {
+	v    []int64
+	n    int64  // number of values
+	file string // temporary file of the values, empty if kept in memory
+	refs int32  // uses left, updated atomically
+}
+
+// reserve accounts n bytes of values kept in memory and reports whether
+// they fit the limit.
+func (e *evaluator) reserve(n int64) bool {
+	if e.limit <= 0 {
+		return true
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.held+n > e.limit {
+		return false
+	}
+
+	e.held += n
+
+	return true
+}
+
+// unreserve accounts n bytes of values dropped from memory.
+func (e *evaluator) unreserve(n int64) {
+	if e.limit <= 0 {
+		return
+	}
+
+	e.mu.Lock()
+	e.held -= n
+	e.mu.Unlock()
+}
+
+// release drops the set after its last use.
+func (e *evaluator) release(s *set) {
+	if atomic.AddInt32(&s.refs, -1) > 0 {
+		return
+	}
+
+	if s.file != "" {
+		_ = os.Remove(s.file)
+		return
+	}
+
+	e.unreserve(valueSize * int64(len(s.v)))
+}
+
+// keep returns the set of the values, spilled if they do not fit the limit.
+func (e *evaluator) keep(v []int64) (*set, error) {
+	if e.reserve(valueSize * int64(len(v))) {
+		return &set{v: v, n: int64(len(v)), refs: 1}, nil
+	}
+
+	w, err := e.spill(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return w.set()
+}
+
+// store reads the values of the iterator into a set kept in memory while
+// it fits the limit and spilled otherwise.
+func (e *evaluator) store(ctx context.Context, it sets.Iterator) (*set, error) {
+	var (
+		v        []int64
+		reserved int64
+		w        *spillWriter
+		n        int
+		err      error
+	)
+
+	for err == nil && it.Next() {
+		if n++; n%checkEvery == 1 {
+			if err = ctx.Err(); err != nil {
+				break
+			}
+
+			switch {
+			case w != nil:
+			case e.reserve(valueSize * checkEvery):
+				reserved += valueSize * checkEvery
+			default:
+				if w, err = e.spill(v); err != nil {
+					break
+				}
+
+				e.unreserve(reserved)
+				v, reserved = nil, 0
+			}
+		}
+
+		switch {
+		case err != nil:
+		case w != nil:
+			err = w.Write(it.Value())
+		default:
+			v = append(v, it.Value())
+		}
+	}
+
+	if err == nil {
+		err = it.Err()
+	}
+
+	switch {
+	case w != nil && err != nil:
+		w.abort()
+		return nil, err
+	case w != nil:
+		return w.set()
+	case err != nil:
+		e.unreserve(reserved)
+		return nil, err
+	}
+
+	e.unreserve(reserved - valueSize*int64(len(v)))
+
+	return &set{v: v, n: int64(len(v)), refs: 1}, nil
+}
+
+// spill writes the values to a temporary file left open for more values.
+func (e *evaluator) spill(v []int64) (*spillWriter, error) {
+	w, err := e.create()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, x := range v {
+		if err = w.Write(x); err != nil {
+			w.abort()
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+// values returns the values of the set read back into memory if spilled.
+func (e *evaluator) values(s *set) ([]int64, error) {
+	if s.file == "" {
+		return s.v, nil
+	}
+
+	r, err := e.read(s)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	v := make([]int64, 0, s.n)
+	for r.Next() {
+		v = append(v, r.Value())
+	}
+
+	return v, r.Err()
+}
+
+// read opens the set for reading.
+func (e *evaluator) read(s *set) (Stream, error) {
+	if s.file == "" {
+		return sliceStream{sets.NewSliceIterator(s.v)}, nil
+	}
+
+	f, err := os.Open(s.file)
+	if err != nil {
+		return nil, err
+	}
+
+	return &spillReader{f: f, r: bufio.NewReader(f), n: s.n}, nil
+}
+
+// create creates a temporary file in the directory of the evaluation.
+func (e *evaluator) create() (*spillWriter, error) {
+	e.mu.Lock()
+
+	var err error
+	if e.dir == "" {
+		e.dir, err = ioutil.TempDir("", "sc-spill-")
+	}
+
+	dir := e.dir
+	e.mu.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := ioutil.TempFile(dir, "set-")
+	if err != nil {
+		return nil, err
+	}
+
+	return &spillWriter{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+// cleanup removes the temporary files of the evaluation.
+func (e *evaluator) cleanup() {
+	if e.dir != "" {
+		_ = os.RemoveAll(e.dir)
+	}
+}
+
+// spillWriter writes a set sorted in ascending order to a temporary file.
+// The first value is written as a varint, the others as uvarint differences
+// from the previous values.
+type spillWriter struct {
+	f    *os.File
+	w    *bufio.Writer
+	buf  [binary.MaxVarintLen64]byte
+	last int64
+	n    int64
+}
+
+func (w *spillWriter) Write(v int64) error {
+	var k int
+	if w.n == 0 {
+		k = binary.PutVarint(w.buf[:], v)
+	} else {
+		k = binary.PutUvarint(w.buf[:], uint64(v-w.last))
+	}
+
+	w.last = v
+	w.n++
+
+	_, err := w.w.Write(w.buf[:k])
+
+	return err
+}
+
+func (w *spillWriter) Close() error {
+	err := w.w.Flush()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// abort closes and removes the file.
+func (w *spillWriter) abort() {
+	_ = w.Close()
+	_ = os.Remove(w.f.Name())
+}
+
+// set closes the file and returns the set written.
+func (w *spillWriter) set() (*set, error) {
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return &set{n: w.n, file: w.f.Name(), refs: 1}, nil
+}
+
+// spillReader reads a set written by spillWriter.
+type spillReader struct {
+	f    *os.File
+	r    *bufio.Reader
+	v    int64
+	i, n int64
+	err  error
+}
+
+func (s *spillReader) Next() bool {
+	if s.err != nil || s.i == s.n {
+		return false
+	}
+
+	if s.i == 0 {
+		s.v, s.err = binary.ReadVarint(s.r)
+	} else {
+		var d uint64
+		d, s.err = binary.ReadUvarint(s.r)
+		s.v += int64(d)
+	}
+
+	if s.err == io.EOF {
+		s.err = io.ErrUnexpectedEOF
+	}
+
+	if s.err != nil {
+		s.err = fmt.Errorf("read %s: %w", s.f.Name(), s.err)
+		return false
+	}
+
+	s.i++
+
+	return true
+}
+
+func (s *spillReader) Value() int64 {
+	return s.v
+}
+
+func (s *spillReader) Err() error {
+	return s.err
+}
+
+func (s *spillReader) Close() error {
+	return s.f.Close()
+}
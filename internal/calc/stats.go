@@ -0,0 +1,169 @@
+package calc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/runningmaster/sc/internal/setfile"
+)
+
+// Stats are statistics of a set known without reading it.
+type Stats struct {
+	Card    int64 // estimated number of values, -1 if unknown
+	Exact   bool  // whether Card is exact
+	Min     int64 // least value, valid if Bounded
+	Max     int64 // greatest value, valid if Bounded
+	Bounded bool  // whether Min and Max are known
+	Bytes   int64 // size of the source in bytes, -1 if unknown
+}
+
+// unknownStats are the statistics of sets known nothing about.
+var unknownStats = Stats{Card: -1, Bytes: -1} //nolint: gochecknoglobals
+
+// empty reports whether the set is known to be empty.
+func (s Stats) empty() bool {
+	return s.Exact && s.Card == 0
+}
+
+// disjoint reports whether the sets are known to have no common values.
+func (s Stats) disjoint(t Stats) bool {
+	return s.empty() || t.empty() || s.Bounded && t.Bounded && (s.Max < t.Min || t.Max < s.Min)
+}
+
+// StatResolver is implemented by resolvers able to tell statistics of sets
+// cheaply. Stat must return an error wrapping ErrNotFound if the resolver
+// knows no set of the given name.
+type StatResolver interface {
+	Resolver
+	Stat(name string) (Stats, error)
+}
+
+// stat returns the statistics of the named set if r supports them.
+func stat(r Resolver, name string) (Stats, error) {
+	if sr, ok := r.(StatResolver); ok {
+		return sr.Stat(name)
+	}
+
+	return unknownStats, nil
+}
+
+// statBlock is the size of the beginning of files read to estimate
+// the number of values.
+const statBlock = 4 << 10
+
+// Stat estimates the number of values of the named file by the size of the
+// file and the lengths of its first lines. Bounds of files are unknown as
+// their values need not be sorted, and so are the sizes of compressed files.
+// The number and the bounds of the values of binary set files are read from
+// their headers. The standard input, pipes and other irregular files are not
+// read as they can be read once only.
+func (FileResolver) Stat(name string) (Stats, error) {
+	if name == setfile.Stdin {
+		return unknownStats, nil
+	}
+
+	fi, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return unknownStats, fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+
+	if err != nil {
+		return unknownStats, err
+	}
+
+	if !fi.Mode().IsRegular() {
+		return unknownStats, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return unknownStats, err
+	}
+	defer f.Close()
+
+	st := Stats{Card: 0, Bytes: fi.Size()}
+
+	b := make([]byte, statBlock)
+
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return unknownStats, err
+	}
+
+	b = b[:n]
+	if setfile.IsBinary(b) {
+		h, err := setfile.ParseHeader(b)
+		if err != nil {
+			return unknownStats, fmt.Errorf("read %s: %w", name, err)
+		}
+
+		return Stats{Card: h.Count, Exact: true, Min: h.Min, Max: h.Max, Bounded: h.Count > 0, Bytes: st.Bytes}, nil
+	}
+
+	if setfile.Detect(b) != setfile.None {
+		return Stats{Card: -1, Bytes: st.Bytes}, nil // the values are not known without decompressing
+	}
+
+	if int64(n) < st.Bytes {
+		// the last line of the block may be cut.
+		if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+			b = b[:i+1]
+		}
+	}
+
+	for _, line := range bytes.Split(b, []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			st.Card++
+		}
+	}
+
+	switch {
+	case int64(n) == st.Bytes:
+		st.Exact = st.Card == 0
+	case st.Card == 0:
+		st.Card = st.Bytes / 2
+	default:
+		st.Card = st.Bytes * st.Card / int64(len(b))
+	}
+
+	return st, nil
+}
+
+// Stat estimates the number of values of the named file of the directory.
+func (d DirResolver) Stat(name string) (Stats, error) {
+	return d.FileResolver.Stat(d.path(name))
+}
+
+// Stat returns the exact statistics of the set of the given name.
+func (m MapResolver) Stat(name string) (Stats, error) {
+	v, ok := m[name]
+	if !ok {
+		return unknownStats, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+
+	st := Stats{Card: int64(len(v)), Exact: true, Bytes: -1}
+	if len(v) > 0 {
+		st.Min, st.Max, st.Bounded = v[0], v[len(v)-1], true
+	}
+
+	return st, nil
+}
+
+// Stat returns the statistics of the first resolver that knows the name.
+// Resolvers not implementing StatResolver end the search with unknown
+// statistics, as they may know the name.
+func (m MultiResolver) Stat(name string) (Stats, error) {
+	for _, r := range m {
+		st, err := stat(r, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+
+		return st, err
+	}
+
+	return unknownStats, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
@@ -0,0 +1,338 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/runningmaster/sc/internal/parser"
+	"github.com/runningmaster/sc/internal/setfile"
+	"github.com/runningmaster/sc/internal/sets"
+)
+
+// Stream is a set read lazily in ascending order.
+type Stream interface {
+	sets.Iterator
+	io.Closer
+}
+
+// StreamResolver is implemented by resolvers able to read sets lazily.
+// Open must return an error wrapping ErrNotFound if the resolver knows
+// no set of the given name.
+type StreamResolver interface {
+	Resolver
+	Open(name string) (Stream, error)
+}
+
+// ContextStreamResolver is implemented by stream resolvers able to stop
+// opening a set when the context is done.
+type ContextStreamResolver interface {
+	StreamResolver
+	OpenContext(ctx context.Context, name string) (Stream, error)
+}
+
+// ExecuteStream evaluates the expression cmd and calls fn for every value
+// of the result in ascending order. Operands of resolvers implementing
+// StreamResolver are read lazily while merged, so their sizes are not
+// limited by memory. Values of files must be sorted in ascending order.
+// Operands and subexpressions repeated in cmd are evaluated once, their
+// values are kept in memory or spilled as limited by WithMemoryLimit.
+func ExecuteStream(cmd string, fn func(v int64) error, opts ...Option) error {
+	return ExecuteStreamContext(context.Background(), cmd, fn, opts...)
+}
+
+// ExecuteStreamContext is like ExecuteStream but stops the evaluation when
+// ctx is done returning *InterruptedError.
+func ExecuteStreamContext(ctx context.Context, cmd string, fn func(v int64) error, opts ...Option) error {
+	c := newConfig(opts)
+
+	ast, err := parser.Parse(cmd)
+	if err != nil {
+		return err
+	}
+
+	p, err := newPlanner(c.resolver).build(ast, nil)
+	if err != nil {
+		return err
+	}
+
+	plans, err := optimize(c.resolver, p)
+	if err != nil {
+		return err
+	}
+
+	e := newEvaluator(c, plans)
+
+	defer func() {
+		for _, s := range e.streams {
+			_ = s.Close()
+		}
+
+		e.cleanup()
+	}()
+
+	it, err := e.iterate(ctx, plans[0])
+	if err != nil {
+		return e.interrupted(ctx, err)
+	}
+
+	for it.Next() {
+		if err = fn(it.Value()); err != nil {
+			return err
+		}
+
+		e.output++
+	}
+
+	if err = it.Err(); err != nil {
+		return e.interrupted(ctx, err)
+	}
+
+	if c.explain == nil {
+		return nil
+	}
+
+	return e.explain(c.explain, []*parser.Node{ast}, nil, plans, nil)
+}
+
+// iterate makes the iterator of the node. Opened streams are appended to
+// e.streams. Values of operands and other nodes used several times are read
+// once and kept in memory or spilled as limited by WithMemoryLimit, ranges
+// are generated anew for every use.
+func (e *evaluator) iterate(ctx context.Context, p *plan) (sets.Iterator, error) {
+	if p.refs < 2 || p.op == parser.TokenRange {
+		return e.stream(ctx, p)
+	}
+
+	s, err := e.shared(p, func() (*set, error) {
+		it, err := e.stream(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+
+		return e.store(ctx, it)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := e.read(s)
+	if err != nil {
+		return nil, err
+	}
+
+	e.streams = append(e.streams, r)
+
+	return r, nil
+}
+
+// stream makes the iterator of the node reading its operands lazily.
+// The iterator stops when ctx is done.
+func (e *evaluator) stream(ctx context.Context, p *plan) (sets.Iterator, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	switch p.op {
+	case parser.TokenIdentifier:
+		s, err := open(ctx, e.r, p.name)
+		if err != nil {
+			return nil, err
+		}
+
+		e.streams = append(e.streams, s)
+
+		if c, ok := s.(byteCounter); ok && e.actual != nil {
+			a := e.observe(p)
+			a.sources = append(a.sources, c)
+		}
+
+		return e.checked(ctx, e.timed(p, s)), nil
+	case parser.TokenRange:
+		return e.checked(ctx, e.timed(p, sets.NewRangeIterator(p.lo, p.hi))), nil
+	}
+
+	its := make([]sets.Iterator, 0, len(p.args))
+
+	for _, a := range p.args {
+		it, err := e.iterate(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+
+		its = append(its, it)
+	}
+
+	it, err := merge(p, its)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.checked(ctx, e.timed(p, it)), nil
+}
+
+// merge returns the iterator of the operator of the node applied to
+// the iterators of its operands.
+func merge(p *plan, its []sets.Iterator) (sets.Iterator, error) {
+	switch p.op {
+	case parser.TokenSUM:
+		return sets.UnionIterator(its...), nil
+	case parser.TokenINT:
+		return sets.InterIterator(its...), nil
+	case parser.TokenDIF:
+		return sets.DiffIterator(its...), nil
+	case parser.TokenXOR:
+		return sets.XorIterator(its...), nil
+	case parser.TokenONE:
+		return sets.OneIterator(its...), nil
+	case parser.TokenATLEAST:
+		return sets.AtLeastIterator(p.k, its...), nil
+	case parser.TokenATMOST:
+		return sets.AtMostIterator(p.k, its...), nil
+	}
+
+	return nil, fmt.Errorf("unknown command %v", p.op)
+}
+
+// open opens the named set lazily if r supports it.
+func open(ctx context.Context, r Resolver, name string) (Stream, error) {
+	if cr, ok := r.(ContextStreamResolver); ok {
+		return cr.OpenContext(ctx, name)
+	}
+
+	if sr, ok := r.(StreamResolver); ok {
+		return sr.Open(name)
+	}
+
+	v, err := resolve(ctx, r, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return sliceStream{sets.NewSliceIterator(v)}, nil
+}
+
+type sliceStream struct {
+	sets.Iterator
+}
+
+func (s sliceStream) SeekGE(v int64) bool {
+	return sets.SeekGE(s.Iterator, v)
+}
+
+func (sliceStream) Close() error {
+	return nil
+}
+
+// fileStream reads a set file skipping repeated values.
+type fileStream struct {
+	f   *setfile.File
+	v   int64
+	ok  bool
+	err error
+}
+
+func (s *fileStream) Next() bool {
+	for s.err == nil {
+		v, err := s.f.Read()
+		if err == io.EOF {
+			return false
+		}
+
+		if err != nil {
+			s.err = err
+			return false
+		}
+
+		if s.ok && v == s.v {
+			continue
+		}
+
+		if s.ok && v < s.v {
+			s.err = &setfile.Error{Name: s.f.Name(), Line: s.f.Line(), Err: setfile.ErrNotSorted}
+			return false
+		}
+
+		s.v, s.ok = v, true
+
+		return true
+	}
+
+	return false
+}
+
+// SeekGE skips the values less than v without reading the blocks of
+// binary set files holding only such values.
+func (s *fileStream) SeekGE(v int64) bool {
+	if s.err != nil {
+		return false
+	}
+
+	if s.ok && v <= s.v {
+		v = s.v + 1
+	}
+
+	if s.err = s.f.Skip(v); s.err != nil {
+		return false
+	}
+
+	return s.Next()
+}
+
+func (s *fileStream) Value() int64 {
+	return s.v
+}
+
+func (s *fileStream) Err() error {
+	return s.err
+}
+
+// Bytes returns the number of bytes read from the file so far.
+func (s *fileStream) Bytes() int64 {
+	return s.f.Bytes()
+}
+
+func (s *fileStream) Close() error {
+	return s.f.Close()
+}
+
+// Open opens the named file for reading. Its values must be sorted
+// in ascending order.
+func (FileResolver) Open(name string) (Stream, error) {
+	f, err := setfile.Open(name)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %v", ErrNotFound, err)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileStream{f: f}, nil
+}
+
+// Open opens the named file of the directory for reading.
+func (d DirResolver) Open(name string) (Stream, error) {
+	return d.FileResolver.Open(d.path(name))
+}
+
+// Open opens the named set with the first resolver that knows it.
+func (m MultiResolver) Open(name string) (Stream, error) {
+	return m.OpenContext(context.Background(), name)
+}
+
+// OpenContext is like Open but passes ctx to resolvers supporting it.
+func (m MultiResolver) OpenContext(ctx context.Context, name string) (Stream, error) {
+	for _, r := range m {
+		s, err := open(ctx, r, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+
+		return s, err
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
@@ -2,20 +2,42 @@ package parser
 
 import (
 	"strconv"
+	"strings"
 )
 
+// Node is a node of AST. An expression node has the operator type and its
+// operands in next in the order of the source. An operand node is a leaf
+// of type TokenIdentifier holding the name in vals, a leaf of type
+// TokenRange holding the bounds in vals, a set literal of type TokenSet
+// holding leaves of types TokenNumber and TokenRange in next, or a leaf of
+// type TokenVar holding the name bound by LET in vals. An expression of type
+// TokenLET holds the name in vals and the value and the body in next.
 type Node struct {
 	typ   TokenType
 	prev  *Node
 	next  []*Node
 	vals  []string
+	k     int
 	depth int
+	pos   int
 }
 
+// Type returns the operator of an expression or the type of an operand.
 func (n *Node) Type() TokenType {
 	return n.typ
 }
 
+// Next returns the operands of an expression in the order of the source.
+func (n *Node) Next() []*Node {
+	return n.next
+}
+
+// Threshold returns the number of sets of ATLEAST and ATMOST expressions.
+func (n *Node) Threshold() int {
+	return n.k
+}
+
+// Vals returns the values of an operand.
 func (n *Node) Vals() []string {
 	return n.vals
 }
@@ -24,11 +46,68 @@ func (n *Node) Depth() int {
 	return n.depth
 }
 
+// Pos returns the byte offset of the node in the input.
+func (n *Node) Pos() int {
+	return n.pos
+}
+
+// String renders the tree of the node: an operator or an operand in
+// a line followed by the trees of its operands, like
+//
+//	DIF
+//	├─ "a"
+//	└─ SUM
+//	   ├─ {1, 3..5}
+//	   └─ x
 func (n *Node) String() string {
-	return strconv.Itoa(n.depth) + " ->" +
-		" type:" + n.typ.String() +
-		" next:" + strconv.Itoa(len(n.next)) +
-		" vals:" + strconv.Itoa(len(n.vals))
+	var b strings.Builder
+
+	n.render(&b, "", "")
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// render writes the line of the node prefixed by first and the lines
+// of its operands prefixed by rest.
+func (n *Node) render(b *strings.Builder, first, rest string) {
+	b.WriteString(first + n.label() + "\n")
+
+	if n.typ == TokenSet {
+		return
+	}
+
+	for i, v := range n.next {
+		if i == len(n.next)-1 {
+			v.render(b, rest+"└─ ", rest+"   ")
+		} else {
+			v.render(b, rest+"├─ ", rest+"│  ")
+		}
+	}
+}
+
+// label returns the line of the node in its tree.
+func (n *Node) label() string {
+	switch n.typ {
+	case TokenIdentifier:
+		return strconv.Quote(n.vals[0])
+	case TokenVar:
+		return n.vals[0]
+	case TokenNumber, TokenRange:
+		return strings.Join(n.vals, "..")
+	case TokenSet:
+		vals := make([]string, len(n.next))
+		for i, v := range n.next {
+			vals[i] = v.label()
+		}
+
+		return "{" + strings.Join(vals, ", ") + "}"
+	case TokenLET:
+		return n.typ.String() + " " + n.vals[0]
+	case TokenATLEAST, TokenATMOST:
+		return n.typ.String() + " " + strconv.Itoa(n.k)
+	}
+
+	return n.typ.String()
 }
 
 type WalkFunc func(node *Node, err error) error
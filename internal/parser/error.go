@@ -0,0 +1,77 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SyntaxError is an error of parsing an expression.
+type SyntaxError struct {
+	Input  string // the expression
+	Offset int    // byte offset of the offending token in Input
+	Line   int    // line number, starting at 1
+	Col    int    // column in runes, starting at 1
+	Msg    string // what is wrong
+	Hint   string // how to fix it, may be empty
+	Err    error  // the kind of the error like ErrMissingOperator
+}
+
+func newSyntaxError(input string, offset int, msg, hint string) *SyntaxError {
+	if offset > len(input) {
+		offset = len(input)
+	}
+
+	line := 1 + strings.Count(input[:offset], "\n")
+	col := 1 + len([]rune(input[strings.LastIndex(input[:offset], "\n")+1:offset]))
+
+	return &SyntaxError{
+		Input:  input,
+		Offset: offset,
+		Line:   line,
+		Col:    col,
+		Msg:    msg,
+		Hint:   hint,
+	}
+}
+
+func (e *SyntaxError) Error() string {
+	return strconv.Itoa(e.Line) + ":" + strconv.Itoa(e.Col) + ": " + e.Msg
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// Context returns the offending line of the input with a caret
+// under the offending token followed by the hint.
+func (e *SyntaxError) Context() string {
+	start := strings.LastIndex(e.Input[:e.Offset], "\n") + 1
+
+	end := strings.IndexByte(e.Input[e.Offset:], '\n')
+	if end < 0 {
+		end = len(e.Input)
+	} else {
+		end += e.Offset
+	}
+
+	var b strings.Builder
+
+	b.WriteString(strings.TrimRight(e.Input[start:end], "\r"))
+	b.WriteByte('\n')
+
+	for _, r := range e.Input[start:e.Offset] {
+		if r == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+
+	b.WriteByte('^')
+
+	if e.Hint != "" {
+		b.WriteString(" " + e.Hint)
+	}
+
+	return b.String()
+}
@@ -14,6 +14,8 @@ type lexer struct {
 	start  int        // start position of this item
 	width  int        // width of last rune read from input
 	depth  int        // nesting depth of [ ] exprs
+	braces int        // nesting depth of { } literals
+	script bool       // whether to scan statements of a script
 	tokens chan token // channel of scanned tokens
 }
 
@@ -33,6 +35,20 @@ func lex(input string) *lexer {
 	return l
 }
 
+// lexScript creates a new scanner for the script. Unlike expressions,
+// scripts have comments and statements terminated by end of lines.
+func lexScript(input string) *lexer {
+	l := &lexer{
+		input:  input,
+		script: true,
+		tokens: make(chan token),
+	}
+
+	go l.run()
+
+	return l
+}
+
 // run runs the state machine for the lexer.
 func (l *lexer) run() {
 	for state := lexAction; state != nil; {
@@ -51,13 +67,18 @@ func (l *lexer) nextToken() token {
 // errorf returns an error token and terminates the scan by passing
 // back a nil pointer that will be the next state, terminating l.nextToken.
 func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.tokens <- token{tokenError, fmt.Sprintf(format, args...), l.start, l.depth}
+	return l.errorAt(l.start, "", format, args...)
+}
+
+// errorAt is like errorf but reports the position and the hint for the user.
+func (l *lexer) errorAt(pos int, hint, format string, args ...interface{}) stateFn {
+	l.tokens <- token{typ: tokenError, val: fmt.Sprintf(format, args...), pos: pos, depth: l.depth, hint: hint}
 	return nil
 }
 
 // emit passes an token back to the client.
 func (l *lexer) emit(t TokenType) {
-	l.tokens <- token{t, l.input[l.start:l.pos], l.start, l.depth}
+	l.tokens <- token{typ: t, val: l.input[l.start:l.pos], pos: l.start, depth: l.depth}
 	l.start = l.pos
 }
 
@@ -101,9 +122,7 @@ func (l *lexer) drain() {
 }
 
 // atTerminator reports whether the input is at valid termination character to
-// appear after an identifier. Breaks .X.Y into two pieces. Also catches cases
-// like "$x+2" not being acceptable without a space, in case we decide one
-// day to implement arithmetic.
+// appear after an identifier.
 func (l *lexer) atTerminator() bool {
 	r := l.peek()
 	if isSpace(r) || isEndOfLine(r) {
@@ -111,11 +130,17 @@ func (l *lexer) atTerminator() bool {
 	}
 
 	switch r {
-	case eof, '.', ',', '|', ':', ')', '(', '[', ']':
+	case eof, '[', ']', '{', '}', ',':
 		return true
 	}
 
-	return false
+	return l.atAssign(r)
+}
+
+// atAssign reports whether r is the '=' of an assignment statement.
+// Elsewhere '=' may appear in file names.
+func (l *lexer) atAssign(r rune) bool {
+	return r == '=' && l.script && l.depth == 0 && l.braces == 0
 }
 
 // lexAction scans the elements inside action delimiters.
@@ -124,14 +149,20 @@ func lexAction(l *lexer) stateFn {
 	case r == eof:
 		l.emit(tokenEOF)
 		return nil
-	case isEndOfLine(r):
-		return l.errorf("unclosed action")
-	case isSpace(r):
+	case l.script && isEndOfLine(r) && l.depth == 0 && l.braces == 0:
+		l.emit(tokenEOL)
+		return lexAction
+	case l.script && r == '#':
+		return lexComment
+	case isSpace(r) || isEndOfLine(r):
 		l.backup()
 		return lexSpace
 	case r == '"':
 		return lexQuote
-	case isAlphaNumeric(r):
+	case l.atAssign(r):
+		l.emit(tokenAssign)
+		return lexAction
+	case isIdentifier(r):
 		l.backup()
 		return lexIdentifier
 	case r == '[':
@@ -141,29 +172,36 @@ func lexAction(l *lexer) stateFn {
 		return lexAction
 	case r == ']':
 		l.emit(tokenBracketRight)
-
 		l.depth--
-		if l.depth < 0 {
-			return l.errorf("unexpected right bracket %#U", r)
-		}
 
 		return lexAction
-	case r <= unicode.MaxASCII && unicode.IsPrint(r):
+	case r == '{':
+		l.emit(tokenBraceLeft)
+		l.braces++
+
+		return lexAction
+	case r == '}':
+		l.emit(tokenBraceRight)
+		l.braces--
+
+		return lexAction
+	case r == ',':
+		l.emit(tokenComma)
 		return lexAction
 	default:
 		return l.errorf("unrecognized character in action: %#U", r)
 	}
 }
 
-// lexSpace scans a run of space characters.
+// lexSpace scans a run of space and end-of-line characters,
+// so expressions may span several lines.
 // We have not consumed the first space, which is known to be present.
-// Take care if there is a trim-marked right delimiter, which starts with a space.
 func lexSpace(l *lexer) stateFn {
 	var r rune
 
 	for {
 		r = l.peek()
-		if !isSpace(r) {
+		if !isSpace(r) && !isEndOfLine(r) {
 			break
 		}
 
@@ -175,6 +213,18 @@ func lexSpace(l *lexer) stateFn {
 	return lexAction
 }
 
+// lexComment scans a comment up to the end of line.
+// The '#' marker is known to be present.
+func lexComment(l *lexer) stateFn {
+	for r := l.peek(); r != eof && !isEndOfLine(r); r = l.peek() {
+		l.next()
+	}
+
+	l.ignore()
+
+	return lexAction
+}
+
 // lexQuote scans a quoted string.
 func lexQuote(l *lexer) stateFn {
 Loop:
@@ -186,34 +236,38 @@ Loop:
 			}
 			fallthrough
 		case eof, '\n':
-			return l.errorf("unterminated quoted string")
+			return l.errorAt(l.start, "missing closing '\"'", "unterminated quoted string")
 		case '"':
 			break Loop
 		}
 	}
-	l.emit(tokenIdentifier)
+	l.emit(TokenIdentifier)
 
 	return lexAction
 }
 
-// lexIdentifier scans an alphanumeric.
+// lexIdentifier scans an alphanumeric or a file name.
 func lexIdentifier(l *lexer) stateFn {
 Loop:
 	for {
 		switch r := l.next(); {
-		case isAlphaNumeric(r):
+		case isIdentifier(r) && !l.atAssign(r):
 			// absorb.
 		default:
 			l.backup()
 			word := l.input[l.start:l.pos]
 			if !l.atTerminator() {
-				return l.errorf("bad character %#U", r)
+				return l.errorAt(l.pos, "separate operands with spaces", "bad character %#U", r)
 			}
 			switch {
+			case isNumber(word):
+				l.emit(TokenNumber)
+			case isRange(word):
+				l.emit(TokenRange)
 			case key(word) > tokenKeyword:
 				l.emit(key(word))
 			default:
-				l.emit(tokenIdentifier)
+				l.emit(TokenIdentifier)
 			}
 			break Loop
 		}
@@ -230,6 +284,16 @@ func key(s string) TokenType {
 		return TokenINT
 	case "dif":
 		return TokenDIF
+	case "xor":
+		return TokenXOR
+	case "one":
+		return TokenONE
+	case "atleast":
+		return TokenATLEAST
+	case "atmost":
+		return TokenATMOST
+	case "let":
+		return TokenLET
 	default:
 		return tokenError
 	}
@@ -249,3 +313,40 @@ func isEndOfLine(r rune) bool {
 func isAlphaNumeric(r rune) bool {
 	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
 }
+
+// isNumber reports whether s is a decimal integer like 12 or -12.
+func isNumber(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	if s == "" {
+		return false
+	}
+
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isRange reports whether s is a range of integers like 1..10 or -5..-1.
+func isRange(s string) bool {
+	i := strings.Index(s, "..")
+	return i >= 0 && isNumber(s[:i]) && isNumber(s[i+2:])
+}
+
+// isIdentifier reports whether r may appear in an identifier,
+// which is an alphanumeric or an unquoted file name like "dir/a.txt".
+func isIdentifier(r rune) bool {
+	if isAlphaNumeric(r) {
+		return true
+	}
+
+	switch r {
+	case eof, '[', ']', '{', '}', ',', '"':
+		return false
+	}
+
+	return !isSpace(r) && !isEndOfLine(r) && unicode.IsPrint(r)
+}
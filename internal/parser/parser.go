@@ -2,60 +2,352 @@ package parser
 
 import (
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 )
 
-// Parse makes AST
+// Errors wrapped by SyntaxError. The grammar is:
+//
+//	expression := "[" operator sets "]" | "[" threshold number sets "]" |
+//		"[" "LET" name set set "]"
+//	sets := set | set sets
+//	set := file | expression | literal | range | name
+//	literal := "{" "}" | "{" elements "}"
+//	elements := element | element "," elements
+//	element := number | range
+//	range := number ".." number
+//	operator := "SUM" | "INT" | "DIF" | "XOR" | "ONE"
+//	threshold := "ATLEAST" | "ATMOST"
+//
+// A number standing alone as an operand is a file name. LET binds the name
+// to the value of the first set within the second one, where the name
+// stands for the value instead of a file. Quoted names are always files.
+var (
+	ErrEmptyInput      = errors.New("empty input")
+	ErrInvalidToken    = errors.New("invalid token")
+	ErrMissingOperator = errors.New("missing operator")
+	ErrEmptyOperands   = errors.New("empty operands")
+	ErrBadThreshold    = errors.New("bad threshold")
+	ErrBadLiteral      = errors.New("bad literal")
+	ErrBadBinding      = errors.New("bad binding")
+	ErrUnexpectedToken = errors.New("unexpected token")
+	ErrUnclosedBracket = errors.New("unclosed bracket")
+)
+
+// parser holds the state of the parsing.
+type parser struct {
+	input  string
+	lex    *lexer
+	scope  []string // names bound by enclosing LET expressions and assignments
+	peeked []token  // tokens backed up
+}
+
+// next returns the next token.
+func (p *parser) next() token {
+	if n := len(p.peeked); n > 0 {
+		t := p.peeked[n-1]
+		p.peeked = p.peeked[:n-1]
+
+		return t
+	}
+
+	return p.lex.nextToken()
+}
+
+// backup backs the token up to be returned by next again.
+func (p *parser) backup(t token) {
+	p.peeked = append(p.peeked, t)
+}
+
+// Parse makes AST of a single expression. Errors are of type *SyntaxError.
 func Parse(input string) (*Node, error) {
-	lex := lex(input)
+	p := &parser{input: input, lex: lex(input)}
+	defer p.lex.drain()
 
-	var tree, n *Node
+	t := p.next()
 
-	for {
-		token := lex.nextToken()
-		if token.typ == tokenEOF {
-			break
+	switch t.typ {
+	case tokenEOF:
+		return nil, p.errorf(t, ErrEmptyInput, "expected '['", "empty expression")
+	case tokenBracketLeft:
+	default:
+		return nil, p.unexpected(t)
+	}
+
+	n, err := p.expr(nil, t)
+	if err != nil {
+		return nil, err
+	}
+
+	switch t = p.next(); t.typ {
+	case tokenEOF:
+	case tokenError, tokenBracketRight:
+		return nil, p.unexpected(t)
+	default:
+		return nil, p.errorf(t, ErrUnexpectedToken, "only one expression is allowed",
+			"unexpected %s after expression", describe(t))
+	}
+
+	return n, nil
+}
+
+// expr parses an expression after its left bracket.
+func (p *parser) expr(prev *Node, left token) (*Node, error) {
+	n := &Node{prev: prev, depth: left.depth - 1, pos: left.pos}
+
+	t := p.next()
+
+	switch {
+	case t.typ == tokenError:
+		return nil, p.unexpected(t)
+	case t.typ > tokenKeyword:
+		n.typ = t.typ
+	default:
+		return nil, p.errorf(t, ErrMissingOperator, "missing operator after '['",
+			"expected operator, got %s", describe(t))
+	}
+
+	if n.typ == TokenATLEAST || n.typ == TokenATMOST {
+		t = p.next()
+
+		k, err := strconv.Atoi(t.val)
+		if t.typ != TokenNumber || err != nil || k < 0 {
+			return nil, p.errorf(t, ErrBadThreshold, "missing number of sets after "+n.typ.String(),
+				"expected number, got %s", describe(t))
 		}
 
-		if token.typ == tokenError {
-			return nil, errors.New(token.val)
+		n.k = k
+	}
+
+	if n.typ == TokenLET {
+		t = p.next()
+		if t.typ != TokenIdentifier || strings.HasPrefix(t.val, `"`) {
+			return nil, p.errorf(t, ErrBadBinding, "missing name after LET",
+				"expected name, got %s", describe(t))
 		}
 
-		switch token.typ {
-		case tokenBracketLeft:
-			n = &Node{prev: n, depth: token.depth - 1}
+		n.vals = []string{t.val}
+	}
 
-			if tree == nil {
-				tree = n
-			} else if n.prev != nil {
-				n.prev.next = append(n.prev.next, n)
-			}
+	for {
+		t = p.next()
 
+		switch t.typ {
 		case tokenBracketRight:
-			if n == nil {
-				return nil, errors.New("syntax error n is nil")
+			if len(n.next) == 0 {
+				return nil, p.errorf(t, ErrEmptyOperands, "missing operands after "+n.typ.String(),
+					"%s has no operands", n.typ)
 			}
 
-			if n.prev != nil {
-				n = n.prev
+			if n.typ == TokenLET {
+				if len(n.next) != 2 {
+					return nil, p.errorf(t, ErrBadBinding, "LET needs a value and an expression using it",
+						"LET has %d operands, want 2", len(n.next))
+				}
+
+				p.scope = p.scope[:len(p.scope)-1]
 			}
 
-		case TokenSUM, TokenINT, TokenDIF:
-			if n == nil {
-				return nil, errors.New("syntax error n is nil")
+			return n, nil
+
+		case tokenBracketLeft:
+			v, err := p.expr(n, t)
+			if err != nil {
+				return nil, err
 			}
 
-			n.typ = token.typ
+			n.next = append(n.next, v)
+
+		case TokenIdentifier, TokenNumber:
+			v, err := p.operand(n, t)
+			if err != nil {
+				return nil, err
+			}
+
+			n.next = append(n.next, v)
+
+		case TokenRange:
+			v, err := p.literal(n, t)
+			if err != nil {
+				return nil, err
+			}
+
+			n.next = append(n.next, v)
+
+		case tokenBraceLeft:
+			v, err := p.set(n, t)
+			if err != nil {
+				return nil, err
+			}
+
+			n.next = append(n.next, v)
+
+		case tokenEOF:
+			return nil, p.errorf(left, ErrUnclosedBracket, "missing matching ']'", "unclosed '['")
+
+		default:
+			return nil, p.unexpected(t)
+		}
+
+		if n.typ == TokenLET && len(n.next) == 1 {
+			p.scope = append(p.scope, n.vals[0])
+		}
+	}
+}
+
+// operand makes a leaf of an identifier. The leaf is of type TokenVar
+// if the identifier is a name bound by LET.
+func (p *parser) operand(prev *Node, t token) (*Node, error) {
+	val := t.val
+	if strings.HasPrefix(val, `"`) {
+		var err error
+		if val, err = strconv.Unquote(val); err != nil {
+			return nil, p.errorf(t, ErrInvalidToken, "", "invalid quoted string")
+		}
+	}
+
+	typ := TokenIdentifier
+	if val == t.val && p.bound(val) {
+		typ = TokenVar
+	}
+
+	return &Node{
+		typ:   typ,
+		prev:  prev,
+		vals:  []string{val},
+		depth: t.depth,
+		pos:   t.pos,
+	}, nil
+}
 
-		case tokenIdentifier:
-			if n == nil {
-				return nil, errors.New("syntax error n is nil")
+// bound reports whether the name is bound by an enclosing LET expression.
+func (p *parser) bound(name string) bool {
+	for i := range p.scope {
+		if p.scope[i] == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// set parses a set literal after its left brace.
+// The elements are leaves of types TokenNumber and TokenRange.
+func (p *parser) set(prev *Node, left token) (*Node, error) {
+	n := &Node{typ: TokenSet, prev: prev, depth: left.depth, pos: left.pos}
+
+	t := p.next()
+	if t.typ == tokenBraceRight {
+		return n, nil
+	}
+
+	for {
+		switch t.typ {
+		case TokenNumber, TokenRange:
+			v, err := p.literal(n, t)
+			if err != nil {
+				return nil, err
 			}
 
-			n.vals = append(n.vals, token.val)
+			n.next = append(n.next, v)
+
+		case tokenError:
+			return nil, p.unexpected(t)
+
+		case tokenEOF:
+			return nil, p.errorf(left, ErrUnclosedBracket, "missing matching '}'", "unclosed '{'")
+
+		default:
+			return nil, p.errorf(t, ErrBadLiteral, "elements of sets are numbers and ranges",
+				"unexpected %s", describe(t))
+		}
+
+		switch t = p.next(); t.typ {
+		case tokenBraceRight:
+			return n, nil
+		case tokenComma:
+			t = p.next()
+		case tokenError:
+			return nil, p.unexpected(t)
+		case tokenEOF:
+			return nil, p.errorf(left, ErrUnclosedBracket, "missing matching '}'", "unclosed '{'")
+		default:
+			return nil, p.errorf(t, ErrBadLiteral, "separate elements with ','",
+				"unexpected %s", describe(t))
+		}
+	}
+}
+
+// literal makes a leaf of a number or a range. The leaf holds
+// the number or the bounds of the range in vals.
+func (p *parser) literal(prev *Node, t token) (*Node, error) {
+	n := &Node{typ: t.typ, prev: prev, depth: t.depth, pos: t.pos}
+
+	bounds := strings.SplitN(t.val, "..", 2)
+	for _, s := range bounds {
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, p.errorf(t, ErrBadLiteral, "the number is out of range", "bad number %s", s)
+		}
+	}
+
+	if len(bounds) == 2 {
+		lo, _ := strconv.ParseInt(bounds[0], 10, 64)
+		hi, _ := strconv.ParseInt(bounds[1], 10, 64)
+
+		if lo > hi {
+			return nil, p.errorf(t, ErrBadLiteral, "the lower bound must not exceed the upper one",
+				"bad range %s", t.val)
 		}
 	}
 
-	lex.drain()
+	n.vals = bounds
+
+	return n, nil
+}
+
+// unexpected returns the error for the token which is not allowed where it is.
+func (p *parser) unexpected(t token) error {
+	var hint string
+
+	switch {
+	case t.typ == tokenError:
+		return p.errorf(t, ErrInvalidToken, t.hint, "%s", t.val)
+	case t.typ == tokenBracketRight:
+		hint = "unbalanced ']'"
+	case t.typ > tokenKeyword && t.depth == 0:
+		hint = "missing '[' before operator"
+	case t.typ > tokenKeyword:
+		hint = "only one operator is allowed in brackets"
+	case t.typ == TokenIdentifier && t.depth == 0:
+		hint = "operands must be inside '[' ']'"
+	}
+
+	return p.errorf(t, ErrUnexpectedToken, hint, "unexpected %s", describe(t))
+}
+
+func (p *parser) errorf(t token, err error, hint, format string, args ...interface{}) error {
+	e := newSyntaxError(p.input, t.pos, fmt.Sprintf(format, args...), hint)
+	e.Err = err
+
+	return e
+}
+
+// describe returns the token as it is named in error messages.
+func describe(t token) string {
+	switch {
+	case t.typ == tokenEOF:
+		return "end of input"
+	case t.typ == tokenEOL:
+		return "end of line"
+	case t.typ == tokenBracketLeft, t.typ == tokenBracketRight, t.typ == tokenBraceLeft,
+		t.typ == tokenBraceRight, t.typ == tokenComma, t.typ == tokenAssign:
+		return "'" + t.typ.String() + "'"
+	case t.typ == TokenNumber, t.typ == TokenRange:
+		return t.typ.String() + " " + t.val
+	case t.typ > tokenKeyword:
+		return "operator " + t.typ.String()
+	}
 
-	return tree, nil
+	return "operand " + t.String()
 }
@@ -0,0 +1,222 @@
+package parser_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/runningmaster/sc/internal/parser"
+)
+
+var ttSyntaxError = []struct { //nolint: gochecknoglobals
+	in      string
+	line    int
+	col     int
+	context string
+}{
+	{`[SUM a b]]`, 1, 10, "[SUM a b]]\n         ^ unbalanced ']'"},
+	{`[SUM a [INT b`, 1, 8, "[SUM a [INT b\n       ^ missing matching ']'"},
+	{`[SUM a "b`, 1, 8, "[SUM a \"b\n       ^ missing closing '\"'"},
+	{`SUM a`, 1, 1, "SUM a\n^ missing '[' before operator"},
+	{"[SUM\ta\tb]]", 1, 10, "[SUM\ta\tb]]\n    \t \t  ^ unbalanced ']'"},
+	{"[SUM a\n  b]]\n", 2, 5, "  b]]\n    ^ unbalanced ']'"},
+}
+
+func TestSyntaxError(t *testing.T) {
+	for i, tt := range ttSyntaxError {
+		_, err := parser.Parse(tt.in)
+
+		var se *parser.SyntaxError
+		if !errors.As(err, &se) {
+			t.Errorf("pos %v: got %v, want syntax error", i, err)
+			continue
+		}
+
+		if se.Line != tt.line || se.Col != tt.col {
+			t.Errorf("pos %v: got %v:%v, want %v:%v", i, se.Line, se.Col, tt.line, tt.col)
+		}
+
+		if se.Context() != tt.context {
+			t.Errorf("pos %v: got %q, want %q", i, se.Context(), tt.context)
+		}
+	}
+}
+
+var ttParseError = []struct { //nolint: gochecknoglobals
+	in  string
+	err error
+}{
+	{``, parser.ErrEmptyInput},
+	{`[a b]`, parser.ErrMissingOperator},
+	{`[]`, parser.ErrMissingOperator},
+	{`[[SUM a] b]`, parser.ErrMissingOperator},
+	{`[SUM]`, parser.ErrEmptyOperands},
+	{`[SUM a [INT]]`, parser.ErrEmptyOperands},
+	{`[SUM a INT b]`, parser.ErrUnexpectedToken},
+	{`[SUM SUM a]`, parser.ErrUnexpectedToken},
+	{`[SUM a] b`, parser.ErrUnexpectedToken},
+	{`[SUM a]]`, parser.ErrUnexpectedToken},
+	{`[SUM a] [SUM b]`, parser.ErrUnexpectedToken},
+	{`a`, parser.ErrUnexpectedToken},
+	{`[SUM a [INT b]`, parser.ErrUnclosedBracket},
+	{`[SUM "a`, parser.ErrInvalidToken},
+	{`[ATLEAST a b]`, parser.ErrBadThreshold},
+	{`[ATMOST -1 a b]`, parser.ErrBadThreshold},
+	{`[ATMOST [SUM a] b]`, parser.ErrBadThreshold},
+	{`[ATLEAST 2]`, parser.ErrEmptyOperands},
+	{`[SUM {1,a}]`, parser.ErrBadLiteral},
+	{`[SUM {1 2}]`, parser.ErrBadLiteral},
+	{`[SUM {1,}]`, parser.ErrBadLiteral},
+	{`[SUM {1,2]`, parser.ErrBadLiteral},
+	{`[SUM {1,2`, parser.ErrUnclosedBracket},
+	{`[SUM 5..1]`, parser.ErrBadLiteral},
+	{`[SUM {99999999999999999999}]`, parser.ErrBadLiteral},
+	{`[SUM a }]`, parser.ErrUnexpectedToken},
+	{`[LET [SUM a] b]`, parser.ErrBadBinding},
+	{`[LET "x" a x]`, parser.ErrBadBinding},
+	{`[LET x a]`, parser.ErrBadBinding},
+	{`[LET x a x x]`, parser.ErrBadBinding},
+	{`[LET x]`, parser.ErrEmptyOperands},
+}
+
+func TestParseError(t *testing.T) {
+	for i, tt := range ttParseError {
+		_, err := parser.Parse(tt.in)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("pos %v: got %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for i, in := range []string{
+		`[SUM a]`,
+		`[SUM a b]`,
+		`  [DIF a [SUM b c] [INT d e]]  `,
+		`[INT "a b.txt" dir/c.txt]`,
+		`[ATLEAST 2 a b c]`,
+		`[DIF a {1,2,3} {}]`,
+		`[INT a 100..200 {-5..-1, 7}]`,
+		`[SUM 12 a.1]`,
+		`[LET x [SUM a b] [DIF x [INT x c]]]`,
+		"[SUM\n\ta\r\n\t[INT b\n\t\tc]\n]\n",
+	} {
+		if _, err := parser.Parse(in); err != nil {
+			t.Errorf("pos %v: %v", i, err)
+		}
+	}
+}
+
+func TestParseLet(t *testing.T) {
+	n, err := parser.Parse(`[LET x x [SUM x "x" [LET y x y]]]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []parser.TokenType
+
+	_ = n.Walk(func(n *parser.Node, _ error) error {
+		got = append(got, n.Type())
+		return nil
+	})
+
+	want := []parser.TokenType{
+		parser.TokenLET,
+		parser.TokenIdentifier, // value of x is the file x
+		parser.TokenSUM,
+		parser.TokenVar,
+		parser.TokenIdentifier, // quoted names are files
+		parser.TokenLET,
+		parser.TokenVar,
+		parser.TokenVar,
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestParseScript(t *testing.T) {
+	in := `# nightly report
+all = [SUM a.txt b.txt]   # both days
+PRINT [INT all
+	c.txt]
+write "out put.txt" [DIF all x=y.txt]
+print all
+`
+
+	st, err := parser.ParseScript(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		typ  parser.StatementType
+		name string
+		expr parser.TokenType
+		line int
+	}{
+		{parser.StatementAssign, "all", parser.TokenSUM, 2},
+		{parser.StatementPrint, "", parser.TokenINT, 3},
+		{parser.StatementWrite, "out put.txt", parser.TokenDIF, 5},
+		{parser.StatementPrint, "", parser.TokenVar, 6},
+	}
+
+	if len(st) != len(want) {
+		t.Fatalf("got %v statements, want %v", len(st), len(want))
+	}
+
+	for i, w := range want {
+		s := st[i]
+		if s.Type != w.typ || s.Name != w.name || s.Expr.Type() != w.expr || s.Line != w.line {
+			t.Errorf("pos %v: got %v %q %v %v, want %v %q %v %v",
+				i, s.Type, s.Name, s.Expr.Type(), s.Line, w.typ, w.name, w.expr, w.line)
+		}
+	}
+}
+
+var ttParseScriptError = []struct { //nolint: gochecknoglobals
+	in  string
+	err error
+}{
+	{"x [SUM a]", parser.ErrBadStatement},
+	{"x = ", parser.ErrBadStatement},
+	{"print [SUM a] [SUM b]", parser.ErrBadStatement},
+	{"write [SUM a]", parser.ErrBadStatement},
+	{"[SUM a]", parser.ErrBadStatement},
+	{"\"x\" = a", parser.ErrBadStatement},
+	{"print [SUM a\n", parser.ErrUnclosedBracket},
+	{"x = [a b]", parser.ErrMissingOperator},
+}
+
+func TestParseScriptError(t *testing.T) {
+	for i, tt := range ttParseScriptError {
+		_, err := parser.ParseScript(tt.in)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("pos %v: got %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestNodeString(t *testing.T) {
+	n, err := parser.Parse(`[DIF "a b" [LET x c [SUM x {1, 3..5}]] [ATLEAST 2 d e f]]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `DIF
+├─ "a b"
+├─ LET x
+│  ├─ "c"
+│  └─ SUM
+│     ├─ x
+│     └─ {1, 3..5}
+└─ ATLEAST 2
+   ├─ "d"
+   ├─ "e"
+   └─ "f"`
+
+	if got := n.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,145 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrBadStatement is wrapped by SyntaxError of a malformed statement.
+var ErrBadStatement = errors.New("bad statement")
+
+// StatementType identifies the type of statements of scripts.
+type StatementType int
+
+const (
+	StatementAssign StatementType = iota // name = set
+	StatementPrint                       // print set
+	StatementWrite                       // write file set
+)
+
+// Statement is a statement of a script.
+type Statement struct {
+	Type StatementType
+	Name string // assigned name or written file
+	Expr *Node  // the set to assign, to print or to write
+	Line int    // line number, starting at 1
+}
+
+// ParseScript parses a script. Statements of the script are terminated by
+// end of lines, expressions may span several lines until they are closed.
+// A '#' starts a comment up to the end of line. The grammar is:
+//
+//	statement := name "=" set | "print" set | "write" file set
+//
+// Assigned names stand for their values in the statements after the assignment.
+// Errors are of type *SyntaxError.
+func ParseScript(input string) ([]*Statement, error) {
+	p := &parser{input: input, lex: lexScript(input)}
+	defer p.lex.drain()
+
+	var res []*Statement
+
+	for {
+		t := p.next()
+
+		switch t.typ {
+		case tokenEOF:
+			return res, nil
+		case tokenEOL:
+			continue
+		case tokenError:
+			return nil, p.unexpected(t)
+		case TokenIdentifier:
+			st, err := p.statement(t)
+			if err != nil {
+				return nil, err
+			}
+
+			res = append(res, st)
+		default:
+			return nil, p.errorf(t, ErrBadStatement, "statements are assignments, print and write",
+				"unexpected %s", describe(t))
+		}
+	}
+}
+
+// statement parses a statement after its first token.
+func (p *parser) statement(t token) (*Statement, error) {
+	st := &Statement{Line: 1 + strings.Count(p.input[:t.pos], "\n")}
+
+	switch {
+	case strings.EqualFold(t.val, "print"):
+		st.Type = StatementPrint
+
+	case strings.EqualFold(t.val, "write"):
+		st.Type = StatementWrite
+
+		f := p.next()
+		if f.typ != TokenIdentifier && f.typ != TokenNumber {
+			return nil, p.errorf(f, ErrBadStatement, "missing file name after write",
+				"expected file name, got %s", describe(f))
+		}
+
+		v, err := p.operand(nil, f)
+		if err != nil {
+			return nil, err
+		}
+
+		st.Name = v.vals[0]
+
+	default:
+		if strings.HasPrefix(t.val, `"`) {
+			return nil, p.errorf(t, ErrBadStatement, "names are not quoted", "bad name %s", t.val)
+		}
+
+		st.Type = StatementAssign
+		st.Name = t.val
+
+		if a := p.next(); a.typ != tokenAssign {
+			return nil, p.errorf(a, ErrBadStatement, "missing '=' after name",
+				"expected '=', got %s", describe(a))
+		}
+	}
+
+	n, err := p.value(p.next())
+	if err != nil {
+		return nil, err
+	}
+
+	st.Expr = n
+
+	switch t = p.next(); t.typ {
+	case tokenEOL:
+	case tokenEOF:
+		p.backup(t)
+	case tokenError:
+		return nil, p.unexpected(t)
+	default:
+		return nil, p.errorf(t, ErrBadStatement, "one statement in a line",
+			"unexpected %s after statement", describe(t))
+	}
+
+	if st.Type == StatementAssign {
+		p.scope = append(p.scope, st.Name)
+	}
+
+	return st, nil
+}
+
+// value parses a set standing alone: an expression, a name, a file or a literal.
+func (p *parser) value(t token) (*Node, error) {
+	switch t.typ {
+	case tokenBracketLeft:
+		return p.expr(nil, t)
+	case tokenBraceLeft:
+		return p.set(nil, t)
+	case TokenRange:
+		return p.literal(nil, t)
+	case TokenIdentifier, TokenNumber:
+		return p.operand(nil, t)
+	case tokenError:
+		return nil, p.unexpected(t)
+	}
+
+	return nil, p.errorf(t, ErrBadStatement, "missing set", "expected set, got %s", describe(t))
+}
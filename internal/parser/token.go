@@ -12,11 +12,25 @@ const (
 	tokenEOF
 	tokenBracketLeft  // '[' inside action
 	tokenBracketRight // ']' inside action
-	tokenIdentifier   // alphanumeric identifier not starting with '.'
+	TokenIdentifier   // alphanumeric identifier or file name
+	tokenBraceLeft    // '{' of a set literal
+	tokenBraceRight   // '}' of a set literal
+	tokenComma        // ',' between elements of a set literal
+	tokenAssign       // '=' of an assignment
+	tokenEOL          // end of a statement of a script
+	TokenNumber       // integer like -12
+	TokenRange        // range of integers like 1..10
+	TokenSet          // set literal, used only by nodes
+	TokenVar          // name bound by LET, used only by nodes
 	tokenKeyword      // used only to delimit the keywords
 	TokenSUM
 	TokenINT
 	TokenDIF
+	TokenXOR
+	TokenONE
+	TokenATLEAST
+	TokenATMOST
+	TokenLET
 )
 
 const eof = -1
@@ -32,8 +46,26 @@ func (t TokenType) Name() string {
 		return "["
 	case tokenBracketRight:
 		return "]"
-	case tokenIdentifier:
+	case TokenIdentifier:
 		return "identifier"
+	case tokenBraceLeft:
+		return "{"
+	case tokenBraceRight:
+		return "}"
+	case tokenComma:
+		return ","
+	case tokenAssign:
+		return "="
+	case tokenEOL:
+		return "end of line"
+	case TokenNumber:
+		return "number"
+	case TokenRange:
+		return "range"
+	case TokenSet:
+		return "set"
+	case TokenVar:
+		return "variable"
 	case tokenKeyword:
 		return "keyword"
 	case TokenSUM:
@@ -42,6 +74,16 @@ func (t TokenType) Name() string {
 		return "INT"
 	case TokenDIF:
 		return "DIF"
+	case TokenXOR:
+		return "XOR"
+	case TokenONE:
+		return "ONE"
+	case TokenATLEAST:
+		return "ATLEAST"
+	case TokenATMOST:
+		return "ATMOST"
+	case TokenLET:
+		return "LET"
 	default:
 		return fmt.Sprintf("token%d", int(t))
 	}
@@ -56,7 +98,8 @@ type token struct {
 	typ   TokenType // The type of this token.
 	val   string    // The value of this token.
 	pos   int       // The starting position, in bytes, of this token in the input string.
-	depth int
+	depth int       // The nesting depth of [ ] exprs.
+	hint  string    // The hint for the user if the token is an error.
 }
 
 func (t token) String() string {
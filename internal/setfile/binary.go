@@ -0,0 +1,269 @@
+package setfile
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Binary set files hold a set of integers sorted in ascending order
+// without duplicates. A file starts with the header:
+//
+//	magic     4 bytes "\x89SCB"
+//	version   1 byte
+//	count     8 bytes, number of values
+//	min, max  8 bytes each, least and greatest values, 0 if count is 0
+//	blockLen  4 bytes, number of values of a block but the last one
+//	blocks    4 bytes, number of blocks
+//
+// followed by the block index of the first value and the offset of every
+// block relative to the end of the index, 8 bytes each, and the blocks.
+// A block holds the differences of its values after the first one from
+// their previous values as uvarints. Fixed size numbers are little-endian.
+const (
+	binaryVersion  = 1
+	headerSize     = 4 + 1 + 8 + 8 + 8 + 4 + 4
+	indexEntrySize = 8 + 8
+
+	// DefaultBlockLen is the number of values of blocks written by
+	// BinaryWriter.
+	DefaultBlockLen = 1 << 12
+)
+
+var binaryMagic = []byte("\x89SCB") //nolint: gochecknoglobals
+
+// ErrCorrupt is returned when a binary set file is malformed.
+var ErrCorrupt = errors.New("corrupt binary set file")
+
+// Header describes the set of a binary set file.
+type Header struct {
+	Version  int
+	Count    int64 // number of values
+	Min, Max int64 // least and greatest values, 0 if Count is 0
+	BlockLen int   // number of values of a block but the last one
+	Blocks   int   // number of blocks
+}
+
+// IsBinary reports whether the data starting with b is a binary set file.
+func IsBinary(b []byte) bool {
+	return bytes.HasPrefix(b, binaryMagic)
+}
+
+// ParseHeader parses the header of a binary set file starting with b.
+func ParseHeader(b []byte) (*Header, error) {
+	if !IsBinary(b) || len(b) < headerSize {
+		return nil, ErrCorrupt
+	}
+
+	le := binary.LittleEndian
+	h := &Header{
+		Version:  int(b[4]),
+		Count:    int64(le.Uint64(b[5:])),
+		Min:      int64(le.Uint64(b[13:])),
+		Max:      int64(le.Uint64(b[21:])),
+		BlockLen: int(le.Uint32(b[29:])),
+		Blocks:   int(le.Uint32(b[33:])),
+	}
+
+	switch {
+	case h.Version != binaryVersion:
+		return nil, fmt.Errorf("unsupported binary set file version %d", h.Version)
+	case h.Count < 0 || h.BlockLen <= 0 || int64(h.Blocks) != (h.Count+int64(h.BlockLen)-1)/int64(h.BlockLen):
+		return nil, ErrCorrupt
+	}
+
+	return h, nil
+}
+
+// blockEntry is an entry of the block index.
+type blockEntry struct {
+	first  int64 // first value of the block
+	offset int64 // offset of the block relative to the end of the index
+}
+
+// BinaryWriter writes a set to a binary set file. The values are kept
+// encoded in memory until Flush, as the header and the index before them
+// hold their number and the number of blocks, so the size of the index is
+// not known until the last value even if the output is seekable.
+type BinaryWriter struct {
+	w        io.Writer
+	blockLen int
+	data     []byte
+	index    []blockEntry
+	n        int64
+	min, max int64
+	buf      [binary.MaxVarintLen64]byte
+}
+
+// NewBinaryWriter returns a new BinaryWriter writing to w.
+func NewBinaryWriter(w io.Writer) *BinaryWriter {
+	return &BinaryWriter{w: w, blockLen: DefaultBlockLen}
+}
+
+// Write adds the integer to the set. The integers must be written in
+// ascending order without duplicates.
+func (w *BinaryWriter) Write(v int64) error {
+	switch {
+	case w.n > 0 && v <= w.max:
+		return fmt.Errorf("write %d after %d: %w", v, w.max, ErrNotSorted)
+	case w.n == 0:
+		w.min = v
+	}
+
+	if w.n%int64(w.blockLen) == 0 {
+		w.index = append(w.index, blockEntry{first: v, offset: int64(len(w.data))})
+	} else {
+		k := binary.PutUvarint(w.buf[:], uint64(v-w.max))
+		w.data = append(w.data, w.buf[:k]...)
+	}
+
+	w.max = v
+	w.n++
+
+	return nil
+}
+
+// Flush writes the file. It must be called once after the last value.
+func (w *BinaryWriter) Flush() error {
+	b := make([]byte, headerSize, headerSize+indexEntrySize*len(w.index))
+	le := binary.LittleEndian
+
+	copy(b, binaryMagic)
+	b[4] = binaryVersion
+	le.PutUint64(b[5:], uint64(w.n))
+	le.PutUint64(b[13:], uint64(w.min))
+	le.PutUint64(b[21:], uint64(w.max))
+	le.PutUint32(b[29:], uint32(w.blockLen))
+	le.PutUint32(b[33:], uint32(len(w.index)))
+
+	var e [indexEntrySize]byte
+
+	for _, v := range w.index {
+		le.PutUint64(e[:], uint64(v.first))
+		le.PutUint64(e[8:], uint64(v.offset))
+		b = append(b, e[:]...)
+	}
+
+	if _, err := w.w.Write(b); err != nil {
+		return err
+	}
+
+	_, err := w.w.Write(w.data)
+
+	return err
+}
+
+// binaryReader reads the values of a binary set file.
+type binaryReader struct {
+	r     *bufio.Reader
+	seek  func(off int64) error // seeks to the offset in the data, nil if not seekable
+	h     *Header
+	index []blockEntry
+	pos   int64 // offset of the reader in the data
+	n     int64 // number of values read
+	v     int64
+}
+
+// newBinaryReader reads the header and the index of the binary set file.
+func newBinaryReader(r *bufio.Reader) (*binaryReader, error) {
+	b := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, ErrCorrupt
+	}
+
+	h, err := ParseHeader(b)
+	if err != nil {
+		return nil, err
+	}
+
+	// the index grows as read, so a corrupt number of blocks fails
+	// at the end of the file instead of allocating it at once.
+	br := &binaryReader{r: r, h: h}
+	e := make([]byte, indexEntrySize)
+
+	for i := 0; i < h.Blocks; i++ {
+		if _, err = io.ReadFull(r, e); err != nil {
+			return nil, ErrCorrupt
+		}
+
+		br.index = append(br.index, blockEntry{
+			first:  int64(binary.LittleEndian.Uint64(e)),
+			offset: int64(binary.LittleEndian.Uint64(e[8:])),
+		})
+	}
+
+	return br, nil
+}
+
+// dataOffset returns the offset of the data in the file.
+func (b *binaryReader) dataOffset() int64 {
+	return headerSize + indexEntrySize*int64(b.h.Blocks)
+}
+
+func (b *binaryReader) ReadByte() (byte, error) {
+	c, err := b.r.ReadByte()
+	if err == nil {
+		b.pos++
+	}
+
+	return c, err
+}
+
+// Read returns the next integer. At the end of the set Read returns io.EOF.
+func (b *binaryReader) Read() (int64, error) {
+	if b.n == b.h.Count {
+		return 0, io.EOF
+	}
+
+	if b.n%int64(b.h.BlockLen) == 0 {
+		e := b.index[b.n/int64(b.h.BlockLen)]
+		if e.offset != b.pos || b.n > 0 && e.first <= b.v {
+			return 0, ErrCorrupt
+		}
+
+		b.v = e.first
+	} else {
+		d, err := binary.ReadUvarint(b)
+		if err == io.EOF || err == io.ErrUnexpectedEOF || err == nil && d == 0 {
+			err = ErrCorrupt
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		b.v += int64(d)
+	}
+
+	b.n++
+
+	return b.v, nil
+}
+
+// skip moves the reader to the block holding the least value not less
+// than v if it is after the next value to be read.
+func (b *binaryReader) skip(v int64) error {
+	i := sort.Search(len(b.index), func(i int) bool { return b.index[i].first > v }) - 1
+	if i < 0 || int64(i)*int64(b.h.BlockLen) <= b.n {
+		return nil
+	}
+
+	off := b.index[i].offset
+	if b.seek == nil || off-b.pos <= int64(b.r.Buffered()) {
+		if _, err := b.r.Discard(int(off - b.pos)); err != nil {
+			return ErrCorrupt
+		}
+	} else if err := b.seek(off); err != nil {
+		return err
+	}
+
+	// the first value of the previous block stands for the values skipped
+	// in the check of the order of the blocks.
+	b.pos, b.n, b.v = off, int64(i)*int64(b.h.BlockLen), b.index[i-1].first
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package setfile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// Compression names the compression of a set file.
+type Compression string
+
+// Compressions detected by Open.
+const (
+	None  Compression = ""
+	Gzip  Compression = "gzip"
+	Bzip2 Compression = "bzip2"
+	Zlib  Compression = "zlib"
+)
+
+// Detect returns the compression of the data starting with b by its magic
+// bytes. Plain set files start with digits, signs or white space, so they
+// are never taken for compressed ones. Zlib headers are checked to use
+// deflate without a preset dictionary, otherwise "80" would be one.
+func Detect(b []byte) Compression {
+	switch {
+	case bytes.HasPrefix(b, []byte{0x1f, 0x8b}):
+		return Gzip
+	case bytes.HasPrefix(b, []byte("BZh")):
+		return Bzip2
+	case len(b) >= 2 && b[0]&0x0f == 8 && b[0]>>4 <= 7 && b[1]&0x20 == 0 && (uint(b[0])<<8|uint(b[1]))%31 == 0:
+		return Zlib
+	}
+
+	return None
+}
+
+// decompress returns the reader of the data of r decompressed as detected
+// by its magic bytes, and the closer of the decompressor if any.
+func decompress(r io.Reader) (io.Reader, io.Closer, Compression, error) {
+	br := bufio.NewReader(r)
+
+	b, err := br.Peek(3)
+	if err != nil && err != io.EOF {
+		return nil, nil, None, err
+	}
+
+	switch c := Detect(b); c {
+	case Gzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, c, fmt.Errorf("gzip: %w", err)
+		}
+
+		return zr, zr, c, nil
+	case Bzip2:
+		return bzip2.NewReader(br), nil, c, nil
+	case Zlib:
+		zr, err := zlib.NewReader(br)
+		if err != nil {
+			return nil, nil, c, fmt.Errorf("zlib: %w", err)
+		}
+
+		return zr, zr, c, nil
+	}
+
+	return br, nil, None, nil
+}
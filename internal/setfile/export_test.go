@@ -0,0 +1,4 @@
+package setfile
+
+// HeaderSize is the size of the header of binary set files.
+const HeaderSize = headerSize
@@ -0,0 +1,378 @@
+// Package setfile reads and writes set files: integers, one integer in a line.
+package setfile
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// ErrNotSorted is returned when values of a set file are out of order.
+var ErrNotSorted = errors.New("not sorted in ascending order")
+
+// Error records a malformed line of a set file.
+type Error struct {
+	Name string // file name, empty if unknown
+	Line int    // line number, starting at 1
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Name == "" {
+		return "line " + strconv.Itoa(e.Line) + ": " + e.Err.Error()
+	}
+
+	return e.Name + ":" + strconv.Itoa(e.Line) + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Reader reads integers from a set file.
+type Reader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+// NewReader returns a new Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{s: bufio.NewScanner(r)}
+}
+
+// Line returns the number of the line read last.
+func (r *Reader) Line() int {
+	return r.line
+}
+
+// Read returns the next integer. Blank lines are skipped.
+// At the end of input Read returns io.EOF.
+func (r *Reader) Read() (int64, error) {
+	for r.s.Scan() {
+		r.line++
+
+		b := bytes.TrimSpace(r.s.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+
+		v, err := strconv.ParseInt(string(b), 10, 64)
+		if err != nil {
+			var numErr *strconv.NumError
+			if errors.As(err, &numErr) {
+				err = numErr.Err
+			}
+
+			return 0, &Error{Line: r.line, Err: fmt.Errorf("invalid integer %q: %w", b, err)}
+		}
+
+		return v, nil
+	}
+
+	if err := r.s.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, io.EOF
+}
+
+// ReadAll reads all integers from r.
+func ReadAll(r io.Reader) ([]int64, error) {
+	var (
+		res []int64
+		rd  = NewReader(r)
+	)
+
+	for {
+		v, err := rd.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, v)
+	}
+}
+
+// File is a set file opened for reading.
+type File struct {
+	f       *os.File
+	c       *countingReader
+	r       *Reader       // reader of text files
+	b       *binaryReader // reader of binary files
+	z       io.Closer     // decompressor, nil if none
+	comp    Compression
+	name    string
+	next    int64 // value read by Skip
+	pending bool  // whether next is to be returned by Read
+}
+
+// Stdin is the name of the standard input.
+const Stdin = "-"
+
+// Open opens the named set file for reading. Files compressed with gzip,
+// bzip2 or zlib are detected by their first bytes and decompressed while
+// read, as are binary set files. The name Stdin opens the standard input,
+// which is not closed by Close.
+func Open(name string) (*File, error) {
+	f := os.Stdin
+
+	if name != Stdin {
+		var err error
+		if f, err = os.Open(name); err != nil {
+			return nil, err
+		}
+	}
+
+	file := &File{f: f, c: &countingReader{r: f}, name: name}
+	if err := file.open(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("read %s: %w", name, err)
+	}
+
+	return file, nil
+}
+
+// open detects the compression and the format of the file.
+func (f *File) open() error {
+	r, z, comp, err := decompress(f.c)
+	if err != nil {
+		return err
+	}
+
+	f.z, f.comp = z, comp
+
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	if b, _ := br.Peek(len(binaryMagic)); !IsBinary(b) {
+		f.r = NewReader(br)
+		return nil
+	}
+
+	if f.b, err = newBinaryReader(br); err != nil {
+		return err
+	}
+
+	if comp == None && f.f != os.Stdin {
+		off := f.b.dataOffset()
+		f.b.seek = func(pos int64) error {
+			if _, err := f.f.Seek(off+pos, io.SeekStart); err != nil {
+				return err
+			}
+
+			br.Reset(f.c)
+
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// Compression returns the compression of the file.
+func (f *File) Compression() Compression {
+	return f.comp
+}
+
+// Bytes returns the number of bytes read from the file so far.
+func (f *File) Bytes() int64 {
+	return f.c.n
+}
+
+// Name returns the name of the file as presented to Open.
+func (f *File) Name() string {
+	return f.name
+}
+
+// Header returns the header of a binary set file, or nil for a text file.
+func (f *File) Header() *Header {
+	if f.b == nil {
+		return nil
+	}
+
+	return f.b.h
+}
+
+// Line returns the number of the line read last, or of the value read
+// last in a binary set file.
+func (f *File) Line() int {
+	if f.b != nil {
+		return int(f.b.n)
+	}
+
+	return f.r.Line()
+}
+
+// Read returns the next integer. At the end of the file Read returns io.EOF.
+func (f *File) Read() (int64, error) {
+	if f.pending {
+		f.pending = false
+		return f.next, nil
+	}
+
+	var (
+		v   int64
+		err error
+	)
+
+	if f.b != nil {
+		v, err = f.b.Read()
+	} else {
+		v, err = f.r.Read()
+	}
+
+	if err == nil || err == io.EOF {
+		return v, err
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		e.Name = f.name
+		return 0, e
+	}
+
+	return 0, fmt.Errorf("read %s: %w", f.name, err)
+}
+
+// Skip skips the integers less than v, so the next Read returns the least
+// integer not less than v. The blocks of binary set files holding only such
+// integers are not read if the file is seekable. The values of a file must
+// be sorted in ascending order.
+func (f *File) Skip(v int64) error {
+	if f.pending && f.next >= v {
+		return nil
+	}
+
+	f.pending = false
+
+	if f.b != nil {
+		if err := f.b.skip(v); err != nil {
+			return fmt.Errorf("read %s: %w", f.name, err)
+		}
+	}
+
+	for {
+		next, err := f.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if next >= v {
+			f.next, f.pending = next, true
+			return nil
+		}
+	}
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	if f.z != nil {
+		_ = f.z.Close()
+	}
+
+	if f.f == os.Stdin {
+		return nil
+	}
+
+	return f.f.Close()
+}
+
+// ReadFile reads all integers from the named file.
+func ReadFile(name string) ([]int64, error) {
+	f, err := Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var res []int64
+
+	for {
+		v, err := f.Read()
+		if err == io.EOF {
+			return res, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, v)
+	}
+}
+
+// Writer writes integers to a set file.
+type Writer struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewWriter returns a new buffered Writer writing to w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Write writes the integer in a line.
+func (w *Writer) Write(v int64) error {
+	w.buf = strconv.AppendInt(w.buf[:0], v, 10)
+	w.buf = append(w.buf, '\n')
+	_, err := w.w.Write(w.buf)
+
+	return err
+}
+
+// Flush writes the buffered data to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// WriteFile writes the integers to the named file, creating it if necessary.
+func WriteFile(name string, v []int64) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+
+	w := NewWriter(f)
+
+	for i := range v {
+		if err = w.Write(v[i]); err != nil {
+			_ = f.Close()
+			return err
+		}
+	}
+
+	if err = w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
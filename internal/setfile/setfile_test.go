@@ -0,0 +1,421 @@
+package setfile_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/runningmaster/sc/internal/setfile"
+	"github.com/runningmaster/sc/internal/testutil"
+)
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+
+	name = filepath.Join(dir, name)
+	if err := ioutil.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return name
+}
+
+func binaryData(t *testing.T, v []int64) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+
+	w := setfile.NewBinaryWriter(&b)
+	for _, x := range v {
+		if err := w.Write(x); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
+
+func gzipData(b []byte) []byte {
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(b)
+	_ = zw.Close()
+
+	return buf.Bytes()
+}
+
+// series returns n values from lo by step.
+func series(n int, lo, step int64) []int64 {
+	v := make([]int64, n)
+	for i := range v {
+		v[i] = lo + int64(i)*step
+	}
+
+	return v
+}
+
+var ttBinary = []struct { //nolint: gochecknoglobals
+	in     []int64
+	blocks int
+}{
+	{nil, 0},
+	{[]int64{-5}, 1},
+	{[]int64{math.MinInt64, 0, math.MaxInt64}, 1},
+	{series(setfile.DefaultBlockLen, 0, 1), 1},
+	{series(setfile.DefaultBlockLen+1, -100, 3), 2},
+	{series(3*setfile.DefaultBlockLen+5, math.MinInt64, 1<<50), 4},
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	dir, cleanup := testutil.TempDir(t)
+	defer cleanup()
+
+	for i, tt := range ttBinary {
+		data := binaryData(t, tt.in)
+		if !setfile.IsBinary(data) {
+			t.Errorf("pos %v: not binary", i)
+		}
+
+		name := writeFile(t, dir, fmt.Sprint(i), data)
+
+		f, err := setfile.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := setfile.Header{Version: 1, Count: int64(len(tt.in)), BlockLen: setfile.DefaultBlockLen, Blocks: tt.blocks}
+		if len(tt.in) > 0 {
+			want.Min, want.Max = tt.in[0], tt.in[len(tt.in)-1]
+		}
+
+		if h := f.Header(); h == nil || *h != want {
+			t.Errorf("pos %v: header: got %+v, want %+v", i, h, want)
+		}
+
+		f.Close()
+
+		out, err := setfile.ReadFile(name)
+		if err != nil || !reflect.DeepEqual(out, tt.in) {
+			t.Errorf("pos %v: got %d values (%v), want %d", i, len(out), err, len(tt.in))
+		}
+	}
+
+	w := setfile.NewBinaryWriter(ioutil.Discard)
+	if err := w.Write(2); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Write(2); !errors.Is(err, setfile.ErrNotSorted) {
+		t.Errorf("repeated value: got %v, want %v", err, setfile.ErrNotSorted)
+	}
+}
+
+// header returns the header of a binary set file.
+func header(version byte, count, min, max int64, blockLen, blocks uint32) []byte {
+	b := make([]byte, setfile.HeaderSize)
+	le := binary.LittleEndian
+
+	copy(b, "\x89SCB")
+	b[4] = version
+	le.PutUint64(b[5:], uint64(count))
+	le.PutUint64(b[13:], uint64(min))
+	le.PutUint64(b[21:], uint64(max))
+	le.PutUint32(b[29:], blockLen)
+	le.PutUint32(b[33:], blocks)
+
+	return b
+}
+
+func TestParseHeader(t *testing.T) {
+	for i, tt := range []struct {
+		in  []byte
+		err string
+	}{
+		{header(1, 0, 0, 0, 4096, 0), ""},
+		{header(1, 4097, -1, 5000, 4096, 2), ""},
+		{header(1, 4097, -1, 5000, 4096, 2)[:setfile.HeaderSize-1], "corrupt binary set file"},
+		{append([]byte("\x89SCA"), header(1, 1, 0, 0, 4096, 1)[4:]...), "corrupt binary set file"},
+		{header(2, 1, 0, 0, 4096, 1), "unsupported binary set file version 2"},
+		{header(1, -1, 0, 0, 4096, 0), "corrupt binary set file"},
+		{header(1, 1, 0, 0, 0, 1), "corrupt binary set file"},
+		{header(1, 4097, 0, 0, 4096, 1), "corrupt binary set file"},
+		{header(1, 1, 0, 0, 4096, 2), "corrupt binary set file"},
+		{[]byte("1\n2\n"), "corrupt binary set file"},
+	} {
+		h, err := setfile.ParseHeader(tt.in)
+
+		switch {
+		case tt.err == "" && (err != nil || h == nil):
+			t.Errorf("pos %v: got %v, want no error", i, err)
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("pos %v: got %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestSkip(t *testing.T) {
+	dir, cleanup := testutil.TempDir(t)
+	defer cleanup()
+
+	var (
+		n    = 3 * setfile.DefaultBlockLen
+		in   = series(n, 0, 3)
+		data = binaryData(t, in)
+		last = int64(3 * (n - 1))
+		text bytes.Buffer
+	)
+
+	w := setfile.NewWriter(&text)
+	for _, v := range in {
+		_ = w.Write(v)
+	}
+
+	_ = w.Flush()
+
+	// steps skip to v and read the next value, -1 at the end of the file.
+	steps := []struct{ v, out int64 }{
+		{-1, 0},
+		{1, 3},
+		{3, 6},
+		{3*int64(2*setfile.DefaultBlockLen+10) + 1, 3 * int64(2*setfile.DefaultBlockLen+11)},
+		{0, 3 * int64(2*setfile.DefaultBlockLen+12)},
+		{last, last},
+		{last, -1},
+	}
+
+	for _, tt := range []struct {
+		name     string
+		data     []byte
+		seekable bool
+	}{
+		{"seekable", data, true},
+		{"gzip", gzipData(data), false},
+		{"text", text.Bytes(), false},
+	} {
+		f, err := setfile.Open(writeFile(t, dir, tt.name, tt.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for j, s := range steps {
+			if err = f.Skip(s.v); err != nil {
+				t.Errorf("%s: step %v: %v", tt.name, j, err)
+				break
+			}
+
+			v, err := f.Read()
+			if err == io.EOF {
+				v, err = -1, nil
+			}
+
+			if err != nil || v != s.out {
+				t.Errorf("%s: step %v: got %v (%v), want %v", tt.name, j, v, err, s.out)
+			}
+		}
+
+		// the blocks skipped in seekable files are not read.
+		if tt.seekable && f.Bytes() >= int64(len(tt.data)) {
+			t.Errorf("%s: read %v bytes of %v", tt.name, f.Bytes(), len(tt.data))
+		}
+
+		f.Close()
+	}
+
+	f, err := setfile.Open(writeFile(t, dir, "pending", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// a value read by Skip is returned by Read after skipping to less values.
+	if err = f.Skip(10); err == nil {
+		err = f.Skip(5)
+	}
+
+	if v, _ := f.Read(); err != nil || v != 12 {
+		t.Errorf("pending: got %v (%v), want 12", v, err)
+	}
+
+	// negative values, skipped to before any read.
+	var (
+		neg  = series(n, -3*int64(n), 3)
+		bin  = binaryData(t, neg)
+		want = neg[2*setfile.DefaultBlockLen+5]
+	)
+
+	for name, data := range map[string][]byte{"negative": bin, "negative.gz": gzipData(bin)} {
+		f, err := setfile.Open(writeFile(t, dir, name, data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = f.Skip(want); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+
+		if v, err := f.Read(); err != nil || v != want {
+			t.Errorf("%s: got %v (%v), want %v", name, v, err, want)
+		}
+
+		f.Close()
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	dir, cleanup := testutil.TempDir(t)
+	defer cleanup()
+
+	var (
+		in    = series(2*setfile.DefaultBlockLen+1, 0, 1000)
+		data  = binaryData(t, in)
+		index = setfile.HeaderSize + 16*3
+	)
+
+	for i, n := range []int{
+		10,                     // in the header
+		setfile.HeaderSize + 8, // in the index
+		index - 1,              // at the last byte of the index
+		index,                  // before the data
+		index + 101,            // in the first block
+		len(data) / 2,          // in the second block
+		len(data) - 2,          // before the uvarint of the last value
+		len(data) - 1,          // in the uvarint of the last value
+	} {
+		_, err := setfile.ReadFile(writeFile(t, dir, fmt.Sprint(i), data[:n]))
+		if !errors.Is(err, setfile.ErrCorrupt) {
+			t.Errorf("pos %v: got %v, want %v", i, err, setfile.ErrCorrupt)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	for i, tt := range []struct {
+		in  string
+		out setfile.Compression
+	}{
+		{"\x1f\x8b\x08", setfile.Gzip},
+		{"BZh9", setfile.Bzip2},
+		{"\x78\x9c", setfile.Zlib},
+		{"\x78\x01", setfile.Zlib},
+		{"\x78\xda", setfile.Zlib},
+		{"\x78\xbb", setfile.None}, // preset dictionary
+		{"80\n", setfile.None},
+		{"8\n", setfile.None},
+		{"8\r\n", setfile.None},
+		{"8\t1\n", setfile.None},
+		{"-8\n", setfile.None},
+		{"8", setfile.None},
+		{"", setfile.None},
+	} {
+		if out := setfile.Detect([]byte(tt.in)); out != tt.out {
+			t.Errorf("pos %v: got %q, want %q", i, out, tt.out)
+		}
+	}
+}
+
+func TestOpenCompressed(t *testing.T) {
+	dir, cleanup := testutil.TempDir(t)
+	defer cleanup()
+
+	var z bytes.Buffer
+
+	zw := zlib.NewWriter(&z)
+	_, _ = zw.Write([]byte("1\n8\n80\n"))
+	_ = zw.Close()
+
+	for _, tt := range []struct {
+		name string
+		data []byte
+		comp setfile.Compression
+		out  []int64
+	}{
+		{"plain", []byte("1\n8\n80\n"), setfile.None, []int64{1, 8, 80}},
+		{"eight", []byte("8\n"), setfile.None, []int64{8}},
+		{"gzip", gzipData([]byte("1\n8\n80\n")), setfile.Gzip, []int64{1, 8, 80}},
+		{"zlib", z.Bytes(), setfile.Zlib, []int64{1, 8, 80}},
+		{"binary.gz", gzipData(binaryData(t, []int64{1, 8, 80})), setfile.Gzip, []int64{1, 8, 80}},
+	} {
+		f, err := setfile.Open(writeFile(t, dir, tt.name, tt.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if f.Compression() != tt.comp {
+			t.Errorf("%s: got %q, want %q", tt.name, f.Compression(), tt.comp)
+		}
+
+		f.Close()
+
+		if out, err := setfile.ReadFile(f.Name()); err != nil || !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("%s: got %v (%v), want %v", tt.name, out, err, tt.out)
+		}
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	for i, tt := range []struct {
+		in   string
+		out  []int64
+		line int
+		err  string
+	}{
+		{"1\n\n 2 \n", []int64{1, 2}, 0, ""},
+		{"1\n\n2\nx\n3\n", []int64{1, 2}, 4, `line 4: invalid integer "x": invalid syntax`},
+		{"\n\n1 2\n", nil, 3, `line 3: invalid integer "1 2": invalid syntax`},
+		{"9223372036854775808\n", nil, 1, `line 1: invalid integer "9223372036854775808": value out of range`},
+	} {
+		var (
+			r   = setfile.NewReader(bytes.NewBufferString(tt.in))
+			out []int64
+			err error
+		)
+
+		for {
+			var v int64
+			if v, err = r.Read(); err != nil {
+				break
+			}
+
+			out = append(out, v)
+		}
+
+		if err == io.EOF {
+			err = nil
+		}
+
+		var fe *setfile.Error
+
+		switch {
+		case !reflect.DeepEqual(out, tt.out):
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		case tt.err == "" && err != nil:
+			t.Errorf("pos %v: got %v, want no error", i, err)
+		case tt.err != "" && (!errors.As(err, &fe) || fe.Line != tt.line || r.Line() != tt.line || err.Error() != tt.err):
+			t.Errorf("pos %v: got %v, want %v", i, err, tt.err)
+		}
+	}
+
+	dir, cleanup := testutil.TempDir(t)
+	defer cleanup()
+
+	name := writeFile(t, dir, "bad", []byte("1\n2\nx\n"))
+	want := name + `:3: invalid integer "x": invalid syntax`
+
+	if _, err := setfile.ReadFile(name); err == nil || err.Error() != want {
+		t.Errorf("file: got %v, want %v", err, want)
+	}
+}
@@ -0,0 +1,595 @@
+package sets
+
+import (
+	"math/bits"
+	"sort"
+)
+
+// Bitmap is a set of integers compressed like a roaring bitmap. Integers are
+// grouped by their high 48 bits into containers of their low 16 bits, held
+// as sorted arrays, bitmaps or runs of consecutive values, whichever is
+// the smallest. Bitmaps are never modified, so they are safe for concurrent
+// use and share containers.
+type Bitmap struct {
+	keys []uint64 // high 48 bits of the values with the sign flipped, ascending
+	cs   []*container
+}
+
+const (
+	signBit     = 1 << 63
+	maxArray    = 4096         // greatest number of values of array containers
+	bitmapWords = 1 << 16 / 64 // number of words of bitmap containers
+
+	// size of bitmap containers in bytes, as serialized.
+	bitmapSize = bitmapWords * 8
+)
+
+// split returns the key of the container of the value and its low bits.
+// Keys of negative values are less than keys of the others.
+func split(v int64) (uint64, uint16) {
+	u := uint64(v) ^ signBit
+	return u >> 16, uint16(u)
+}
+
+// join returns the value of the low bits in the container of the key.
+func join(key uint64, low uint16) int64 {
+	return int64((key<<16 | uint64(low)) ^ signBit)
+}
+
+// interval is a run of consecutive values from start to last.
+type interval struct {
+	start, last uint16
+}
+
+// container holds the low bits of the values of a key in arr if it is
+// an array container, in bits if it is a bitmap container and in runs
+// if it is a run container. Containers are never empty, array containers
+// hold at most maxArray values and bitmap containers more.
+type container struct {
+	n    int // number of values
+	arr  []uint16
+	bits []uint64
+	runs []interval
+}
+
+// fromArray returns the container of the sorted values, nil if there are
+// none. It is a run container if that is smaller.
+func fromArray(a []uint16) *container {
+	if len(a) == 0 {
+		return nil
+	}
+
+	r := 1
+
+	for i := 1; i < len(a); i++ {
+		if a[i] != a[i-1]+1 {
+			r++
+		}
+	}
+
+	if 2+4*r >= 2*len(a) {
+		return &container{n: len(a), arr: a}
+	}
+
+	runs := make([]interval, 0, r)
+	start := 0
+
+	for i := 1; i <= len(a); i++ {
+		if i == len(a) || a[i] != a[i-1]+1 {
+			runs = append(runs, interval{a[start], a[i-1]})
+			start = i
+		}
+	}
+
+	return &container{n: len(a), runs: runs}
+}
+
+// fromBits returns the smallest container of the values set in the bitmap,
+// nil if there are none.
+func fromBits(b []uint64) *container {
+	var (
+		n, r  int
+		carry uint64
+	)
+
+	for _, w := range b {
+		n += bits.OnesCount64(w)
+		r += bits.OnesCount64(w &^ (w<<1 | carry))
+		carry = w >> 63
+	}
+
+	size := bitmapSize
+	if n <= maxArray {
+		size = 2 * n
+	}
+
+	switch {
+	case n == 0:
+		return nil
+	case 2+4*r < size:
+		return &container{n: n, runs: runsOf(b, r)}
+	case n <= maxArray:
+		return &container{n: n, arr: arrayOf(b, n)}
+	}
+
+	return &container{n: n, bits: b}
+}
+
+// arrayOf returns the n values set in the bitmap.
+func arrayOf(b []uint64, n int) []uint16 {
+	a := make([]uint16, 0, n)
+
+	for i, w := range b {
+		for ; w != 0; w &= w - 1 {
+			a = append(a, uint16(i*64+bits.TrailingZeros64(w)))
+		}
+	}
+
+	return a
+}
+
+// runsOf returns the r runs of the values set in the bitmap.
+func runsOf(b []uint64, r int) []interval {
+	runs := make([]interval, 0, r)
+
+	for i := next(b, 0, false); i < 1<<16; {
+		j := next(b, i, true)
+		runs = append(runs, interval{uint16(i), uint16(j - 1)})
+		i = next(b, j, false)
+	}
+
+	return runs
+}
+
+// next returns the position of the first bit from i set in the bitmap,
+// or clear if clear is true, 1<<16 if there is none.
+func next(b []uint64, i int, clear bool) int {
+	for i < 1<<16 {
+		w := b[i>>6]
+		if clear {
+			w = ^w
+		}
+
+		if w >>= uint(i & 63); w != 0 {
+			return i + bits.TrailingZeros64(w)
+		}
+
+		i = (i | 63) + 1
+	}
+
+	return i
+}
+
+// setRange sets the bits from lo to hi exclusive.
+func setRange(b []uint64, lo, hi int) {
+	for ; lo < hi && lo&63 != 0; lo++ {
+		b[lo>>6] |= 1 << uint(lo&63)
+	}
+
+	for ; lo+64 <= hi; lo += 64 {
+		b[lo>>6] = ^uint64(0)
+	}
+
+	for ; lo < hi; lo++ {
+		b[lo>>6] |= 1 << uint(lo&63)
+	}
+}
+
+// toBits returns the bitmap of the values. It must not be modified.
+func (c *container) toBits() []uint64 {
+	if c.bits != nil {
+		return c.bits
+	}
+
+	b := make([]uint64, bitmapWords)
+
+	for _, x := range c.arr {
+		b[x>>6] |= 1 << (x & 63)
+	}
+
+	for _, r := range c.runs {
+		setRange(b, int(r.start), int(r.last)+1)
+	}
+
+	return b
+}
+
+func (c *container) contains(x uint16) bool {
+	switch {
+	case c.bits != nil:
+		return c.bits[x>>6]&(1<<(x&63)) != 0
+	case c.runs != nil:
+		i := sort.Search(len(c.runs), func(i int) bool { return c.runs[i].last >= x })
+		return i < len(c.runs) && c.runs[i].start <= x
+	}
+
+	i := sort.Search(len(c.arr), func(i int) bool { return c.arr[i] >= x })
+
+	return i < len(c.arr) && c.arr[i] == x
+}
+
+// appendTo appends the values of the container of the key to dst.
+func (c *container) appendTo(dst []int64, key uint64) []int64 {
+	switch {
+	case c.bits != nil:
+		for i, w := range c.bits {
+			for ; w != 0; w &= w - 1 {
+				dst = append(dst, join(key, uint16(i*64+bits.TrailingZeros64(w))))
+			}
+		}
+	case c.runs != nil:
+		for _, r := range c.runs {
+			for x := int(r.start); x <= int(r.last); x++ {
+				dst = append(dst, join(key, uint16(x)))
+			}
+		}
+	default:
+		for _, x := range c.arr {
+			dst = append(dst, join(key, x))
+		}
+	}
+
+	return dst
+}
+
+func unionContainers(a, b *container) *container {
+	if a.arr != nil && b.arr != nil && a.n+b.n <= maxArray {
+		return fromArray(unionUint16(a.arr, b.arr))
+	}
+
+	x, y := a.toBits(), b.toBits()
+	res := make([]uint64, bitmapWords)
+
+	for i := range res {
+		res[i] = x[i] | y[i]
+	}
+
+	return fromBits(res)
+}
+
+func interContainers(a, b *container) *container {
+	switch {
+	case a.arr != nil:
+		return fromArray(filterUint16(a.arr, b, true))
+	case b.arr != nil:
+		return fromArray(filterUint16(b.arr, a, true))
+	}
+
+	x, y := a.toBits(), b.toBits()
+	res := make([]uint64, bitmapWords)
+
+	for i := range res {
+		res[i] = x[i] & y[i]
+	}
+
+	return fromBits(res)
+}
+
+func diffContainers(a, b *container) *container {
+	if a.arr != nil {
+		return fromArray(filterUint16(a.arr, b, false))
+	}
+
+	x, y := a.toBits(), b.toBits()
+	res := make([]uint64, bitmapWords)
+
+	for i := range res {
+		res[i] = x[i] &^ y[i]
+	}
+
+	return fromBits(res)
+}
+
+func unionUint16(a, b []uint16) []uint16 {
+	res := make([]uint16, 0, len(a)+len(b))
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			res = append(res, a[i])
+			i++
+		case a[i] > b[j]:
+			res = append(res, b[j])
+			j++
+		default:
+			res = append(res, a[i])
+			i++
+			j++
+		}
+	}
+
+	res = append(res, a[i:]...)
+
+	return append(res, b[j:]...)
+}
+
+// filterUint16 returns the values of a the container has if keep is true,
+// or does not have otherwise.
+func filterUint16(a []uint16, c *container, keep bool) []uint16 {
+	var res []uint16
+
+	for _, x := range a {
+		if c.contains(x) == keep {
+			res = append(res, x)
+		}
+	}
+
+	return res
+}
+
+// NewBitmap returns the bitmap of the values. Values sorted in ascending
+// order are added fastest, repeated values are skipped.
+func NewBitmap(v []int64) *Bitmap {
+	b := &Bitmap{}
+
+	for i := 0; i < len(v); {
+		key, _ := split(v[i])
+
+		j := i + 1
+		for j < len(v) && v[j] >= v[j-1] && (uint64(v[j])^signBit)>>16 == key {
+			j++
+		}
+
+		if j < len(v) && v[j] < v[j-1] {
+			v = append([]int64(nil), v...)
+			sort.Slice(v, func(i, j int) bool { return v[i] < v[j] })
+
+			return NewBitmap(v)
+		}
+
+		var c *container
+
+		if j-i <= maxArray {
+			a := make([]uint16, 0, j-i)
+
+			for _, x := range v[i:j] {
+				if low := uint16(x); len(a) == 0 || a[len(a)-1] != low {
+					a = append(a, low)
+				}
+			}
+
+			c = fromArray(a)
+		} else {
+			bits := make([]uint64, bitmapWords)
+
+			for _, x := range v[i:j] {
+				bits[uint16(x)>>6] |= 1 << (uint16(x) & 63)
+			}
+
+			c = fromBits(bits)
+		}
+
+		b.add(key, c)
+		i = j
+	}
+
+	return b
+}
+
+// Card returns the number of values of the set.
+func (b *Bitmap) Card() int64 {
+	var n int64
+	for _, c := range b.cs {
+		n += int64(c.n)
+	}
+
+	return n
+}
+
+// Contains reports whether the set has the value.
+func (b *Bitmap) Contains(v int64) bool {
+	key, low := split(v)
+	i := sort.Search(len(b.keys), func(i int) bool { return b.keys[i] >= key })
+
+	return i < len(b.keys) && b.keys[i] == key && b.cs[i].contains(low)
+}
+
+// Int64s returns the values of the set in ascending order.
+func (b *Bitmap) Int64s() []int64 {
+	res := make([]int64, 0, b.Card())
+	for i, c := range b.cs {
+		res = c.appendTo(res, b.keys[i])
+	}
+
+	return res
+}
+
+// Iterator returns an iterator over the values of the set in ascending order.
+func (b *Bitmap) Iterator() Iterator {
+	return &bitmapIterator{b: b}
+}
+
+// UnionBitmap finds the union of all the given sets.
+func UnionBitmap(args ...*Bitmap) *Bitmap {
+	return foldBitmap(args, unionBitmap)
+}
+
+// InterBitmap finds the intersection of all the given sets.
+// The intersection of less than two sets is empty.
+func InterBitmap(args ...*Bitmap) *Bitmap {
+	if len(args) < 2 {
+		return &Bitmap{}
+	}
+
+	args = append([]*Bitmap(nil), args...)
+	sort.SliceStable(args, func(i, j int) bool {
+		return len(args[i].keys) < len(args[j].keys)
+	})
+
+	return foldBitmap(args, interBitmap)
+}
+
+// DiffBitmap finds the difference of the first set and all the others.
+func DiffBitmap(args ...*Bitmap) *Bitmap {
+	return foldBitmap(args, diffBitmap)
+}
+
+func foldBitmap(args []*Bitmap, fn func(a, b *Bitmap) *Bitmap) *Bitmap {
+	if len(args) == 0 {
+		return &Bitmap{}
+	}
+
+	res := args[0]
+	for _, b := range args[1:] {
+		res = fn(res, b)
+	}
+
+	return res
+}
+
+func unionBitmap(a, b *Bitmap) *Bitmap {
+	res := &Bitmap{
+		keys: make([]uint64, 0, len(a.keys)+len(b.keys)),
+		cs:   make([]*container, 0, len(a.keys)+len(b.keys)),
+	}
+
+	i, j := 0, 0
+	for i < len(a.keys) && j < len(b.keys) {
+		switch {
+		case a.keys[i] < b.keys[j]:
+			res.add(a.keys[i], a.cs[i])
+			i++
+		case a.keys[i] > b.keys[j]:
+			res.add(b.keys[j], b.cs[j])
+			j++
+		default:
+			res.add(a.keys[i], unionContainers(a.cs[i], b.cs[j]))
+			i++
+			j++
+		}
+	}
+
+	res.keys = append(append(res.keys, a.keys[i:]...), b.keys[j:]...)
+	res.cs = append(append(res.cs, a.cs[i:]...), b.cs[j:]...)
+
+	return res
+}
+
+func interBitmap(a, b *Bitmap) *Bitmap {
+	res := &Bitmap{}
+
+	i, j := 0, 0
+	for i < len(a.keys) && j < len(b.keys) {
+		switch {
+		case a.keys[i] < b.keys[j]:
+			i += sort.Search(len(a.keys)-i, func(k int) bool { return a.keys[i+k] >= b.keys[j] })
+		case a.keys[i] > b.keys[j]:
+			j += sort.Search(len(b.keys)-j, func(k int) bool { return b.keys[j+k] >= a.keys[i] })
+		default:
+			res.add(a.keys[i], interContainers(a.cs[i], b.cs[j]))
+			i++
+			j++
+		}
+	}
+
+	return res
+}
+
+func diffBitmap(a, b *Bitmap) *Bitmap {
+	res := &Bitmap{
+		keys: make([]uint64, 0, len(a.keys)),
+		cs:   make([]*container, 0, len(a.keys)),
+	}
+
+	i, j := 0, 0
+	for i < len(a.keys) {
+		switch {
+		case j == len(b.keys) || a.keys[i] < b.keys[j]:
+			res.add(a.keys[i], a.cs[i])
+			i++
+		case a.keys[i] > b.keys[j]:
+			j++
+		default:
+			res.add(a.keys[i], diffContainers(a.cs[i], b.cs[j]))
+			i++
+			j++
+		}
+	}
+
+	return res
+}
+
+// add appends the container of the key unless it is nil.
+func (b *Bitmap) add(key uint64, c *container) {
+	if c != nil {
+		b.keys = append(b.keys, key)
+		b.cs = append(b.cs, c)
+	}
+}
+
+// bitmapIterator reads the values of a bitmap a container at a time.
+type bitmapIterator struct {
+	b   *Bitmap
+	i   int     // index of the next container
+	buf []int64 // values of the current container
+	j   int     // index of the current value in buf
+}
+
+func (it *bitmapIterator) Next() bool {
+	it.j++
+
+	for it.j >= len(it.buf) {
+		if it.i == len(it.b.cs) {
+			it.buf, it.j = it.buf[:0], 0
+			return false
+		}
+
+		it.buf = it.b.cs[it.i].appendTo(it.buf[:0], it.b.keys[it.i])
+		it.i++
+		it.j = 0
+	}
+
+	return true
+}
+
+// SeekGE skips the containers of values less than v.
+func (it *bitmapIterator) SeekGE(v int64) bool {
+	if n := len(it.buf); it.j+1 < n && it.buf[n-1] >= v {
+		rest := it.buf[it.j+1:]
+		it.j += 1 + sort.Search(len(rest), func(k int) bool { return rest[k] >= v })
+
+		return true
+	}
+
+	key, _ := split(v)
+	keys := it.b.keys[it.i:]
+	it.i += sort.Search(len(keys), func(k int) bool { return keys[k] >= key })
+	it.buf, it.j = it.buf[:0], 0
+
+	for it.Next() {
+		if it.buf[len(it.buf)-1] >= v {
+			rest := it.buf[it.j:]
+			it.j += sort.Search(len(rest), func(k int) bool { return rest[k] >= v })
+
+			return true
+		}
+
+		it.j = len(it.buf) - 1
+	}
+
+	return false
+}
+
+func (it *bitmapIterator) Value() int64 {
+	return it.buf[it.j]
+}
+
+func (it *bitmapIterator) Err() error {
+	return nil
+}
+
+// Sets of at least minDense values less than denseGap apart on average
+// are dense, the containers of their values are bitmaps or runs.
+const (
+	minDense = 1 << 12
+	denseGap = 1 << 16 / maxArray
+)
+
+// Dense reports whether the sorted set is dense enough to be combined with
+// others faster as a bitmap than as a slice.
+func Dense(v []int64) bool {
+	n := len(v)
+
+	return n >= minDense && (uint64(v[n-1])-uint64(v[0]))/uint64(n) < denseGap
+}
@@ -0,0 +1,376 @@
+package sets_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/runningmaster/sc/internal/sets"
+	"github.com/runningmaster/sc/internal/sortutil"
+)
+
+func bitmaps(in [][]int64) []*sets.Bitmap {
+	res := make([]*sets.Bitmap, 0, len(in))
+	for i := range in {
+		res = append(res, sets.NewBitmap(in[i]))
+	}
+
+	return res
+}
+
+func TestUnionBitmap(t *testing.T) {
+	for i, tt := range ttUnion {
+		out := sets.UnionBitmap(bitmaps(tt.in)...).Int64s()
+		if !equalSets(out, tt.out) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+	}
+}
+
+func TestInterBitmap(t *testing.T) {
+	for i, tt := range ttInter {
+		out := sets.InterBitmap(bitmaps(tt.in)...).Int64s()
+		if !equalSets(out, tt.out) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+	}
+}
+
+func TestDiffBitmap(t *testing.T) {
+	for i, tt := range ttDiff {
+		out := sets.DiffBitmap(bitmaps(tt.in)...).Int64s()
+		if !equalSets(out, tt.out) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+	}
+}
+
+func TestNewBitmap(t *testing.T) {
+	for i, tt := range []struct {
+		in  []int64
+		out []int64
+	}{
+		{[]int64{3, 1, 2, 1, -5}, []int64{-5, 1, 2, 3}},
+		{[]int64{1, 1, 65536, 65536}, []int64{1, 65536}},
+		{randomRange(-10000, 10000), sortutil.SortInt64(randomRange(-10000, 10000))},
+	} {
+		if out := sets.NewBitmap(tt.in).Int64s(); !equalSets(out, tt.out) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+	}
+}
+
+// randomSet returns about n random values from lo to lo+span-1, and runs
+// of values if runs is true.
+func randomSet(r *rand.Rand, n int, lo, span int64, runs bool) []int64 {
+	v := make([]int64, 0, n)
+
+	for len(v) < n {
+		x := lo + r.Int63n(span)
+		v = append(v, x)
+
+		for k := r.Intn(200); runs && k > 0 && len(v) < n && x < lo+span-1; k-- {
+			x++
+			v = append(v, x)
+		}
+	}
+
+	return sortutil.DeDupInt64(sortutil.SortInt64(v))
+}
+
+var ttBitmapRandom = []struct { //nolint: gochecknoglobals
+	n        int
+	lo, span int64
+	runs     bool
+}{
+	{100, 0, 1 << 20, false},             // arrays
+	{20000, 0, 1 << 17, false},           // bitmaps
+	{20000, 0, 1 << 18, true},            // runs
+	{5000, -1 << 17, 1 << 18, false},     // negative values
+	{3000, math.MinInt64, 1 << 18, true}, // least values
+	{3000, math.MaxInt64 - 1<<18, 1 << 18, true},
+	{1000, math.MinInt64 / 2, math.MaxInt64, false}, // sparse
+}
+
+func TestBitmapRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	for i, tt := range ttBitmapRandom {
+		in := make([][]int64, 3)
+		for j := range in {
+			in[j] = randomSet(r, tt.n, tt.lo, tt.span, tt.runs)
+		}
+
+		b := bitmaps(in)
+
+		if out := b[0].Int64s(); !reflect.DeepEqual(out, in[0]) {
+			t.Errorf("pos %v: values differ: got %d values, want %d", i, len(out), len(in[0]))
+		}
+
+		if b[0].Card() != int64(len(in[0])) {
+			t.Errorf("pos %v: card: got %v, want %v", i, b[0].Card(), len(in[0]))
+		}
+
+		for _, op := range []struct {
+			name string
+			got  *sets.Bitmap
+			want []int64
+		}{
+			{"union", sets.UnionBitmap(b...), sets.UnionInt64Sorted(in...)},
+			{"inter", sets.InterBitmap(b...), sets.InterInt64Sorted(in...)},
+			{"diff", sets.DiffBitmap(b...), sets.DiffInt64Sorted(in...)},
+		} {
+			if out := op.got.Int64s(); !equalSets(out, op.want) {
+				t.Errorf("pos %v: %s: got %d values, want %d", i, op.name, len(out), len(op.want))
+			}
+
+			if out, _ := sets.Collect(op.got.Iterator()); !equalSets(out, op.want) {
+				t.Errorf("pos %v: %s iterator: got %d values, want %d", i, op.name, len(out), len(op.want))
+			}
+
+			var buf bytes.Buffer
+
+			if _, err := op.got.WriteTo(&buf); err != nil {
+				t.Fatal(err)
+			}
+
+			back, err := sets.ReadBitmap(&buf)
+			if err != nil || !equalSets(back.Int64s(), op.want) {
+				t.Errorf("pos %v: %s serialized: got %v", i, op.name, err)
+			}
+		}
+
+		for j, v := range in[1][:10] {
+			if !b[1].Contains(v) || j > 0 && in[1][j-1] < v-1 && b[1].Contains(v-1) {
+				t.Errorf("pos %v: contains %d or %d", i, v, v-1)
+			}
+		}
+
+		// seeking the values of one set in the other is their intersection.
+		var (
+			it  = b[0].Iterator()
+			ok  = it.Next()
+			out []int64
+		)
+
+		for _, v := range in[1] {
+			if ok && it.Value() < v {
+				ok = sets.SeekGE(it, v)
+			}
+
+			if ok && it.Value() == v {
+				out = append(out, v)
+			}
+		}
+
+		if want := sets.InterInt64Sorted(in[0], in[1]); !equalSets(out, want) {
+			t.Errorf("pos %v: seek: got %d values, want %d", i, len(out), len(want))
+		}
+	}
+}
+
+func TestBitmapFormat(t *testing.T) {
+	for i, tt := range []struct {
+		in  []int64
+		out []byte
+	}{
+		{nil, []byte{0x3a, 0x30, 0, 0, 0, 0, 0, 0}},
+		{[]int64{1, 2, 3, 65541}, []byte{
+			0x3a, 0x30, 0, 0, 2, 0, 0, 0, // cookie, containers
+			0, 0, 2, 0, 1, 0, 0, 0, // keys, values - 1
+			24, 0, 0, 0, 30, 0, 0, 0, // offsets
+			1, 0, 2, 0, 3, 0, 5, 0,
+		}},
+		{sets.UnionInt64Sorted([]int64{1000}, sortutil.SortInt64(randomRange(0, 100))), []byte{
+			0x3b, 0x30, 0, 0, 1, // cookie, run flags
+			0, 0, 100, 0, // key, values - 1
+			2, 0, 0, 0, 99, 0, 232, 3, 0, 0, // runs
+		}},
+	} {
+		b := sets.NewBitmap(tt.in)
+
+		var buf bytes.Buffer
+		if _, err := b.WriteTo32(&buf); err != nil || !bytes.Equal(buf.Bytes(), tt.out) {
+			t.Errorf("pos %v: got %v (%v), want %v", i, buf.Bytes(), err, tt.out)
+		}
+
+		back, err := sets.ReadBitmap32(&buf)
+		if err != nil || !equalSets(back.Int64s(), tt.in) {
+			t.Errorf("pos %v: read: got %v (%v), want %v", i, back, err, tt.in)
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if _, err := sets.NewBitmap([]int64{-1, 1}).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{
+		2, 0, 0, 0, 0, 0, 0, 0, // buckets
+		0, 0, 0, 0, 0x3a, 0x30, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 16, 0, 0, 0, 1, 0,
+		0xff, 0xff, 0xff, 0xff, 0x3a, 0x30, 0, 0, 1, 0, 0, 0, 0xff, 0xff, 0, 0, 16, 0, 0, 0, 0xff, 0xff,
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("64-bit: got %v, want %v", buf.Bytes(), want)
+	}
+
+	if _, err := sets.NewBitmap([]int64{-1}).WriteTo32(&buf); err == nil {
+		t.Errorf("32-bit: negative values written")
+	}
+}
+
+func randomRange(lo, hi int64) []int64 {
+	v := make([]int64, 0, hi-lo)
+	for _, i := range rand.Perm(int(hi - lo)) {
+		v = append(v, lo+int64(i))
+	}
+
+	return v
+}
+
+func TestReadBitmapCorrupt(t *testing.T) {
+	for i, in := range [][]byte{
+		{},
+		{0x3a, 0x30, 0, 0, 1},
+		{0x3a, 0x30, 0, 0, 1, 0, 0, 0, 0, 0, 1, 0, 12, 0, 0, 0, 2, 0, 1, 0},                  // not sorted
+		{0x3b, 0x30, 0, 0, 1, 0, 0, 2, 0, 1, 0, 5, 0, 3, 0},                                  // wrong number of values
+		{0x3b, 0x30, 0, 0, 1, 0, 0, 5, 0, 2, 0, 0, 0, 3, 0, 2, 0, 0, 0},                      // overlapping runs
+		{0x3b, 0x30, 0, 0, 1, 0, 0, 5, 0, 1, 0, 0xfe, 0xff, 5, 0},                            // run out of the container
+		{0x39, 0x30, 0, 0, 0, 0, 0, 0},                                                       // unknown cookie
+		{0x3a, 0x30, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 7, 0}, // keys not ascending
+	} {
+		if _, err := sets.ReadBitmap32(bytes.NewReader(in)); !errors.Is(err, sets.ErrCorruptBitmap) {
+			t.Errorf("pos %v: got %v, want %v", i, err, sets.ErrCorruptBitmap)
+		}
+	}
+}
+
+func TestDense(t *testing.T) {
+	for i, tt := range []struct {
+		in  []int64
+		out bool
+	}{
+		{nil, false},
+		{sortutil.SortInt64(randomRange(0, 100)), false},
+		{sortutil.SortInt64(randomRange(0, 100000)), true},
+		{randomSet(rand.New(rand.NewSource(1)), 10000, 0, 1<<30, false), false},
+		{[]int64{math.MinInt64, math.MaxInt64}, false},
+	} {
+		if out := sets.Dense(tt.in); out != tt.out {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+	}
+}
+
+var ( //nolint: gochecknoglobals
+	denseData [][]int64
+	denseOnce sync.Once
+)
+
+// dense returns the sets of the dense benchmarks, made at the first call.
+func dense() [][]int64 {
+	denseOnce.Do(func() {
+		denseData = [][]int64{
+			randomSet(rand.New(rand.NewSource(1)), 1<<20, 0, 1<<22, false),
+			randomSet(rand.New(rand.NewSource(2)), 1<<20, 0, 1<<22, true),
+			randomSet(rand.New(rand.NewSource(3)), 1<<20, 1<<20, 1<<22, false),
+		}
+	})
+
+	return denseData
+}
+
+func BenchmarkUnionInt64SortedDense(b *testing.B) {
+	var (
+		in = dense()
+		r  []int64
+	)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		r = sets.UnionInt64Sorted(in...)
+	}
+
+	result = r
+}
+
+func BenchmarkUnionBitmapDense(b *testing.B) {
+	var (
+		in = dense()
+		r  []int64
+	)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		r = sets.UnionBitmap(bitmaps(in)...).Int64s()
+	}
+
+	result = r
+}
+
+func BenchmarkInterInt64SortedDense(b *testing.B) {
+	var (
+		in = dense()
+		r  []int64
+	)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		r = sets.InterInt64Sorted(in...)
+	}
+
+	result = r
+}
+
+func BenchmarkInterBitmapDense(b *testing.B) {
+	var (
+		in = dense()
+		r  []int64
+	)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		r = sets.InterBitmap(bitmaps(in)...).Int64s()
+	}
+
+	result = r
+}
+
+func BenchmarkDiffInt64SortedDense(b *testing.B) {
+	var (
+		in = dense()
+		r  []int64
+	)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		r = sets.DiffInt64Sorted(in...)
+	}
+
+	result = r
+}
+
+func BenchmarkDiffBitmapDense(b *testing.B) {
+	var (
+		in = dense()
+		r  []int64
+	)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		r = sets.DiffBitmap(bitmaps(in)...).Int64s()
+	}
+
+	result = r
+}
@@ -0,0 +1,434 @@
+package sets
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Iterator iterates over a set in ascending order.
+type Iterator interface {
+	// Next advances the iterator to the next value and reports whether
+	// there is one.
+	Next() bool
+	// Value returns the current value.
+	Value() int64
+	// Err returns the error that stopped the iteration, if any.
+	Err() error
+}
+
+// Seeker is implemented by iterators able to skip values cheaply.
+type Seeker interface {
+	Iterator
+	// SeekGE advances the iterator at least once, to the least value not
+	// less than v, and reports whether there is one.
+	SeekGE(v int64) bool
+}
+
+// SeekGE advances the iterator at least once, to the least value not less
+// than v, and reports whether there is one. Iterators not implementing
+// Seeker are advanced value by value.
+func SeekGE(it Iterator, v int64) bool {
+	if s, ok := it.(Seeker); ok {
+		return s.SeekGE(v)
+	}
+
+	for it.Next() {
+		if it.Value() >= v {
+			return true
+		}
+	}
+
+	return false
+}
+
+type sliceIterator struct {
+	v []int64
+	i int
+}
+
+// NewSliceIterator returns an Iterator over the values of the slice.
+// The slice must be sorted in ascending order without duplicates.
+func NewSliceIterator(v []int64) Iterator {
+	return &sliceIterator{v: v, i: -1}
+}
+
+func (s *sliceIterator) Next() bool {
+	if s.i < len(s.v) {
+		s.i++
+	}
+
+	return s.i < len(s.v)
+}
+
+func (s *sliceIterator) SeekGE(v int64) bool {
+	if s.i >= len(s.v) {
+		return false
+	}
+
+	rest := s.v[s.i+1:]
+	s.i += 1 + sort.Search(len(rest), func(i int) bool { return rest[i] >= v })
+
+	return s.i < len(s.v)
+}
+
+func (s *sliceIterator) Value() int64 {
+	return s.v[s.i]
+}
+
+func (s *sliceIterator) Err() error {
+	return nil
+}
+
+type rangeIterator struct {
+	v, hi int64
+	init  bool
+	done  bool
+}
+
+// NewRangeIterator returns an Iterator over the integers from lo to hi inclusive.
+func NewRangeIterator(lo, hi int64) Iterator {
+	return &rangeIterator{v: lo, hi: hi, done: lo > hi}
+}
+
+func (r *rangeIterator) Next() bool {
+	switch {
+	case r.done:
+		return false
+	case !r.init:
+		r.init = true
+	case r.v == r.hi:
+		r.done = true
+		return false
+	default:
+		r.v++
+	}
+
+	return true
+}
+
+func (r *rangeIterator) SeekGE(v int64) bool {
+	if !r.Next() {
+		return false
+	}
+
+	switch {
+	case v > r.hi:
+		r.v, r.done = r.hi, true
+		return false
+	case v > r.v:
+		r.v = v
+	}
+
+	return true
+}
+
+func (r *rangeIterator) Value() int64 {
+	return r.v
+}
+
+func (r *rangeIterator) Err() error {
+	return nil
+}
+
+// Collect reads all the values of the iterator.
+func Collect(it Iterator) ([]int64, error) {
+	var res []int64
+	for it.Next() {
+		res = append(res, it.Value())
+	}
+
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// UnionIterator streams the union of all the given sets.
+// The iterators must yield values in ascending order without duplicates.
+func UnionIterator(args ...Iterator) Iterator {
+	return newMergeIterator(args, func(count, n int) bool {
+		return count > 0
+	})
+}
+
+// InterIterator streams the intersection of all the given sets. The sets
+// are advanced to the values of each other, so the values skipped are not
+// read from iterators implementing Seeker. The intersection of less than
+// two sets is empty. The iterators must yield values in ascending order
+// without duplicates.
+func InterIterator(args ...Iterator) Iterator {
+	return &interIterator{args: args, done: len(args) < 2}
+}
+
+type interIterator struct {
+	args []Iterator
+	init bool
+	done bool
+	v    int64
+	err  error
+}
+
+func (it *interIterator) Next() bool {
+	if it.done {
+		return false
+	}
+
+	first := it.args[0]
+	if !first.Next() {
+		return it.stop(first)
+	}
+
+	v := first.Value()
+
+	if !it.init {
+		it.init = true
+
+		for _, a := range it.args[1:] {
+			if !a.Next() {
+				return it.stop(a)
+			}
+		}
+	}
+
+	for {
+		agree := true
+
+		for _, a := range it.args {
+			if a.Value() < v && !SeekGE(a, v) {
+				return it.stop(a)
+			}
+
+			if a.Value() > v {
+				v, agree = a.Value(), false
+			}
+		}
+
+		if agree {
+			it.v = v
+			return true
+		}
+	}
+}
+
+// stop ends the iteration as the iterator a is exhausted.
+func (it *interIterator) stop(a Iterator) bool {
+	it.done, it.err = true, a.Err()
+	return false
+}
+
+func (it *interIterator) Value() int64 {
+	return it.v
+}
+
+func (it *interIterator) Err() error {
+	return it.err
+}
+
+// XorIterator streams the elements present in an odd number of the given sets.
+// The iterators must yield values in ascending order without duplicates.
+func XorIterator(args ...Iterator) Iterator {
+	return newMergeIterator(args, func(count, n int) bool {
+		return count%2 == 1
+	})
+}
+
+// OneIterator streams the elements present in exactly one of the given sets.
+// The iterators must yield values in ascending order without duplicates.
+func OneIterator(args ...Iterator) Iterator {
+	return newMergeIterator(args, func(count, n int) bool {
+		return count == 1
+	})
+}
+
+// AtLeastIterator streams the elements present in at least k of the given sets.
+// The iterators must yield values in ascending order without duplicates.
+func AtLeastIterator(k int, args ...Iterator) Iterator {
+	return newMergeIterator(args, func(count, n int) bool {
+		return count >= k
+	})
+}
+
+// AtMostIterator streams the elements present in at most k of the given sets.
+// The iterators must yield values in ascending order without duplicates.
+func AtMostIterator(k int, args ...Iterator) Iterator {
+	return newMergeIterator(args, func(count, n int) bool {
+		return count <= k
+	})
+}
+
+// DiffIterator streams the difference between the first set and all the rest ones.
+// The rest sets are advanced to the values of the first one, so the values
+// skipped are not read from iterators implementing Seeker. The iterators must
+// yield values in ascending order without duplicates.
+func DiffIterator(args ...Iterator) Iterator {
+	if len(args) == 0 {
+		return NewSliceIterator(nil)
+	}
+
+	return &diffIterator{a: args[0], b: args[1:], bok: make([]bool, len(args)-1)}
+}
+
+type diffIterator struct {
+	a     Iterator
+	b     []Iterator
+	bok   []bool
+	binit bool
+	v     int64
+	err   error
+}
+
+func (d *diffIterator) Next() bool {
+	if d.err != nil {
+		return false
+	}
+
+next:
+	for d.a.Next() {
+		v := d.a.Value()
+
+		if !d.binit {
+			d.binit = true
+
+			for i, b := range d.b {
+				d.bok[i] = b.Next()
+			}
+		}
+
+		for i, b := range d.b {
+			if d.bok[i] && b.Value() < v {
+				d.bok[i] = SeekGE(b, v)
+			}
+
+			if !d.bok[i] {
+				if d.err = b.Err(); d.err != nil {
+					return false
+				}
+			}
+
+			if d.bok[i] && b.Value() == v {
+				continue next
+			}
+		}
+
+		d.v = v
+
+		return true
+	}
+
+	d.err = d.a.Err()
+
+	return false
+}
+
+func (d *diffIterator) Value() int64 {
+	return d.v
+}
+
+func (d *diffIterator) Err() error {
+	return d.err
+}
+
+// mergeIterator merges the iterators in a single pass and yields
+// the values whose number of occurrences is accepted by keep.
+type mergeIterator struct {
+	args []Iterator
+	h    iterHeap
+	keep func(count, n int) bool
+	init bool
+	v    int64
+	err  error
+}
+
+func newMergeIterator(args []Iterator, keep func(count, n int) bool) *mergeIterator {
+	return &mergeIterator{args: args, keep: keep}
+}
+
+func (m *mergeIterator) start() bool {
+	m.init = true
+	m.h = make(iterHeap, 0, len(m.args))
+
+	for _, it := range m.args {
+		if it.Next() {
+			m.h = append(m.h, iterItem{it: it, v: it.Value()})
+			continue
+		}
+
+		if m.err = it.Err(); m.err != nil {
+			return false
+		}
+	}
+
+	heap.Init(&m.h)
+
+	return true
+}
+
+func (m *mergeIterator) Next() bool {
+	if !m.init && !m.start() {
+		return false
+	}
+
+	for len(m.h) > 0 && m.err == nil {
+		v := m.h[0].v
+
+		var count int
+		for len(m.h) > 0 && m.h[0].v == v {
+			count++
+
+			it := m.h[0].it
+			if it.Next() {
+				m.h[0].v = it.Value()
+				heap.Fix(&m.h, 0)
+
+				continue
+			}
+
+			if m.err = it.Err(); m.err != nil {
+				return false
+			}
+
+			heap.Pop(&m.h)
+		}
+
+		if m.keep(count, len(m.args)) {
+			m.v = v
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *mergeIterator) Value() int64 {
+	return m.v
+}
+
+func (m *mergeIterator) Err() error {
+	return m.err
+}
+
+type iterItem struct {
+	it Iterator
+	v  int64
+}
+
+// iterHeap is a min-heap of iterators ordered by their current values.
+type iterHeap []iterItem
+
+func (h iterHeap) Len() int           { return len(h) }
+func (h iterHeap) Less(i, j int) bool { return h[i].v < h[j].v }
+func (h iterHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *iterHeap) Push(x interface{}) {
+	*h = append(*h, x.(iterItem))
+}
+
+func (h *iterHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+
+	return x
+}
@@ -0,0 +1,182 @@
+package sets_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/runningmaster/sc/internal/sets"
+)
+
+func iterators(in [][]int64) []sets.Iterator {
+	res := make([]sets.Iterator, 0, len(in))
+	for i := range in {
+		res = append(res, sets.NewSliceIterator(in[i]))
+	}
+
+	return res
+}
+
+func equalSets(a, b []int64) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func TestUnionIterator(t *testing.T) {
+	for i, tt := range ttUnion {
+		out, err := sets.Collect(sets.UnionIterator(iterators(tt.in)...))
+		if err != nil || !equalSets(out, tt.out) {
+			t.Errorf("pos %v: got %v (%v), want %v", i, out, err, tt.out)
+		}
+	}
+}
+
+func TestInterIterator(t *testing.T) {
+	for i, tt := range ttInter {
+		out, err := sets.Collect(sets.InterIterator(iterators(tt.in)...))
+		if err != nil || !equalSets(out, tt.out) {
+			t.Errorf("pos %v: got %v (%v), want %v", i, out, err, tt.out)
+		}
+	}
+}
+
+func TestDiffIterator(t *testing.T) {
+	for i, tt := range ttDiff {
+		out, err := sets.Collect(sets.DiffIterator(iterators(tt.in)...))
+		if err != nil || !equalSets(out, tt.out) {
+			t.Errorf("pos %v: got %v (%v), want %v", i, out, err, tt.out)
+		}
+	}
+}
+
+type errIterator struct{ err error }
+
+func (e errIterator) Next() bool   { return false }
+func (e errIterator) Value() int64 { return 0 }
+func (e errIterator) Err() error   { return e.err }
+
+func TestIteratorError(t *testing.T) {
+	want := errors.New("broken")
+
+	for i, it := range []sets.Iterator{
+		sets.UnionIterator(sets.NewSliceIterator([]int64{1}), errIterator{want}),
+		sets.InterIterator(sets.NewSliceIterator([]int64{1}), errIterator{want}),
+		sets.DiffIterator(sets.NewSliceIterator([]int64{1}), errIterator{want}),
+		sets.DiffIterator(errIterator{want}, sets.NewSliceIterator([]int64{1})),
+	} {
+		if _, err := sets.Collect(it); !errors.Is(err, want) {
+			t.Errorf("pos %v: got %v, want %v", i, err, want)
+		}
+	}
+}
+
+func TestXorIterator(t *testing.T) {
+	for i, tt := range ttXor {
+		out, err := sets.Collect(sets.XorIterator(iterators(tt.in)...))
+		if err != nil || !equalSets(out, tt.out) {
+			t.Errorf("pos %v: got %v (%v), want %v", i, out, err, tt.out)
+		}
+	}
+}
+
+func TestOneIterator(t *testing.T) {
+	for i, tt := range ttOne {
+		out, err := sets.Collect(sets.OneIterator(iterators(tt.in)...))
+		if err != nil || !equalSets(out, tt.out) {
+			t.Errorf("pos %v: got %v (%v), want %v", i, out, err, tt.out)
+		}
+	}
+}
+
+func TestThresholdIterator(t *testing.T) {
+	for i, tt := range ttThreshold {
+		out, err := sets.Collect(sets.AtLeastIterator(tt.k, iterators(tt.in)...))
+		if err != nil || !equalSets(out, tt.least) {
+			t.Errorf("pos %v: got %v (%v), want %v", i, out, err, tt.least)
+		}
+
+		out, err = sets.Collect(sets.AtMostIterator(tt.k, iterators(tt.in)...))
+		if err != nil || !equalSets(out, tt.most) {
+			t.Errorf("pos %v: got %v (%v), want %v", i, out, err, tt.most)
+		}
+	}
+}
+
+func TestRangeIterator(t *testing.T) {
+	const max = 1<<63 - 1
+
+	for i, tt := range []struct {
+		lo, hi int64
+		out    []int64
+	}{
+		{1, 3, []int64{1, 2, 3}},
+		{-1, -1, []int64{-1}},
+		{2, 1, nil},
+		{max - 1, max, []int64{max - 1, max}},
+	} {
+		out, err := sets.Collect(sets.NewRangeIterator(tt.lo, tt.hi))
+		if err != nil || !equalSets(out, tt.out) {
+			t.Errorf("pos %v: got %v (%v), want %v", i, out, err, tt.out)
+		}
+	}
+}
+
+// plainIterator hides the SeekGE method of the iterator.
+type plainIterator struct{ sets.Iterator }
+
+func TestSeekGE(t *testing.T) {
+	for i, tt := range []struct {
+		it   func() sets.Iterator
+		next int // values read before seeking
+		v    int64
+		out  []int64
+	}{
+		{func() sets.Iterator { return sets.NewSliceIterator([]int64{1, 3, 5, 7}) }, 0, 4, []int64{5, 7}},
+		{func() sets.Iterator { return sets.NewSliceIterator([]int64{1, 3, 5, 7}) }, 0, 0, []int64{1, 3, 5, 7}},
+		{func() sets.Iterator { return sets.NewSliceIterator([]int64{1, 3, 5, 7}) }, 2, 1, []int64{5, 7}},
+		{func() sets.Iterator { return sets.NewSliceIterator([]int64{1, 3, 5, 7}) }, 1, 8, nil},
+		{func() sets.Iterator { return sets.NewSliceIterator([]int64{1, 3, 5, 7}) }, 5, 0, nil}, // exhausted
+		{func() sets.Iterator { return sets.NewSliceIterator(nil) }, 1, 0, nil},
+		{func() sets.Iterator { return sets.NewRangeIterator(1, 7) }, 0, 4, []int64{4, 5, 6, 7}},
+		{func() sets.Iterator { return sets.NewRangeIterator(1, 7) }, 3, 2, []int64{4, 5, 6, 7}},
+		{func() sets.Iterator { return sets.NewRangeIterator(1, 7) }, 1, 9, nil},
+		{func() sets.Iterator { return sets.NewRangeIterator(1, 7) }, 8, 0, nil},
+		{func() sets.Iterator { return sets.NewRangeIterator(2, 1) }, 0, 0, nil},
+		{func() sets.Iterator { return plainIterator{sets.NewRangeIterator(1, 7)} }, 1, 6, []int64{6, 7}},
+	} {
+		it := tt.it()
+		for j := 0; j < tt.next; j++ {
+			it.Next()
+		}
+
+		var out []int64
+		if sets.SeekGE(it, tt.v) {
+			out = append(out, it.Value())
+			rest, _ := sets.Collect(it)
+			out = append(out, rest...)
+		}
+
+		if !equalSets(out, tt.out) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+	}
+}
+
+func TestInterIteratorPlain(t *testing.T) {
+	for i, tt := range ttInter {
+		its := iterators(tt.in)
+		for j := range its {
+			if j%2 == 1 {
+				its[j] = plainIterator{its[j]}
+			}
+		}
+
+		out, err := sets.Collect(sets.InterIterator(its...))
+		if err != nil || !equalSets(out, tt.out) {
+			t.Errorf("pos %v: got %v (%v), want %v", i, out, err, tt.out)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package sets
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+)
+
+// Bitmaps are serialized in the formats of the roaring bitmap specification,
+// https://github.com/RoaringBitmap/RoaringFormatSpec. The 32-bit format
+// holds containers of 16-bit keys, the portable 64-bit format holds 32-bit
+// bitmaps of the high 32 bits of the values in ascending order of them as
+// unsigned integers. Values of Bitmap are signed, so negative values are
+// written after the others as they are by implementations using uint64.
+const (
+	serialCookieNoRuns = 12346
+	serialCookie       = 12347
+	noOffsetThreshold  = 4
+)
+
+// ErrCorruptBitmap is returned when a serialized bitmap is malformed.
+var ErrCorruptBitmap = errors.New("corrupt roaring bitmap")
+
+// WriteTo writes the bitmap in the portable 64-bit roaring format.
+func (b *Bitmap) WriteTo(w io.Writer) (int64, error) {
+	// keys of non-negative values come first as unsigned.
+	s := 0
+	for s < len(b.keys) && b.keys[s]>>47 == 0 {
+		s++
+	}
+
+	var (
+		keys   = append(append([]uint64(nil), b.keys[s:]...), b.keys[:s]...)
+		cs     = append(append([]*container(nil), b.cs[s:]...), b.cs[:s]...)
+		groups [][2]int // index ranges of keys of the same high 32 bits
+	)
+
+	for i := range keys {
+		if i == 0 || keys[i]>>16 != keys[i-1]>>16 {
+			groups = append(groups, [2]int{i, i})
+		}
+
+		groups[len(groups)-1][1]++
+	}
+
+	buf := make([]byte, 8, 8+len(groups)*4)
+	binary.LittleEndian.PutUint64(buf, uint64(len(groups)))
+
+	for _, g := range groups {
+		buf = appendUint32(buf, high32(keys[g[0]]))
+		buf = appendBitmap32(buf, keys[g[0]:g[1]], cs[g[0]:g[1]])
+	}
+
+	n, err := w.Write(buf)
+
+	return int64(n), err
+}
+
+// WriteTo32 writes the bitmap in the 32-bit roaring format. The values must
+// be from 0 to 1<<32-1.
+func (b *Bitmap) WriteTo32(w io.Writer) (int64, error) {
+	if len(b.keys) > 0 && (high32(b.keys[0]) != 0 || high32(b.keys[len(b.keys)-1]) != 0) {
+		return 0, fmt.Errorf("values out of the range of 32-bit roaring bitmaps")
+	}
+
+	n, err := w.Write(appendBitmap32(nil, b.keys, b.cs))
+
+	return int64(n), err
+}
+
+// high32 returns the high 32 bits of the values of the container key.
+func high32(key uint64) uint32 {
+	return uint32(key>>16) ^ 1<<31
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// appendBitmap32 appends the containers of a 32-bit bitmap to b. The low 16
+// bits of the keys are written.
+func appendBitmap32(b []byte, keys []uint64, cs []*container) []byte {
+	start, runs := len(b), false
+
+	for _, c := range cs {
+		runs = runs || c.runs != nil
+	}
+
+	if runs {
+		b = appendUint32(b, serialCookie|uint32(len(cs)-1)<<16)
+		flags := make([]byte, (len(cs)+7)/8)
+
+		for i, c := range cs {
+			if c.runs != nil {
+				flags[i/8] |= 1 << uint(i%8)
+			}
+		}
+
+		b = append(b, flags...)
+	} else {
+		b = appendUint32(b, serialCookieNoRuns)
+		b = appendUint32(b, uint32(len(cs)))
+	}
+
+	for i, c := range cs {
+		b = appendUint16(b, uint16(keys[i]))
+		b = appendUint16(b, uint16(c.n-1))
+	}
+
+	if !runs || len(cs) >= noOffsetThreshold {
+		off := len(b) - start + 4*len(cs)
+
+		for _, c := range cs {
+			b = appendUint32(b, uint32(off))
+			off += c.size()
+		}
+	}
+
+	for _, c := range cs {
+		switch {
+		case c.bits != nil:
+			for _, w := range c.bits {
+				b = appendUint32(appendUint32(b, uint32(w)), uint32(w>>32))
+			}
+		case c.runs != nil:
+			b = appendUint16(b, uint16(len(c.runs)))
+			for _, r := range c.runs {
+				b = appendUint16(appendUint16(b, r.start), r.last-r.start)
+			}
+		default:
+			for _, x := range c.arr {
+				b = appendUint16(b, x)
+			}
+		}
+	}
+
+	return b
+}
+
+// size returns the size of the serialized container in bytes.
+func (c *container) size() int {
+	switch {
+	case c.bits != nil:
+		return bitmapSize
+	case c.runs != nil:
+		return 2 + 4*len(c.runs)
+	}
+
+	return 2 * len(c.arr)
+}
+
+// ReadBitmap reads a bitmap in the portable 64-bit roaring format.
+func ReadBitmap(r io.Reader) (*Bitmap, error) {
+	br := &bitmapReader{r: bufio.NewReader(r)}
+
+	n, err := br.uint64()
+	if err != nil {
+		return nil, err
+	}
+
+	var pos, neg Bitmap
+
+	for i := uint64(0); i < n; i++ {
+		hi, err := br.uint32()
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 && hi <= br.hi {
+			return nil, fmt.Errorf("%w: high bits %d after %d", ErrCorruptBitmap, hi, br.hi)
+		}
+
+		br.hi = hi
+
+		b := &pos
+		if hi >= 1<<31 {
+			b = &neg
+		}
+
+		if err = br.bitmap32(b, uint64(hi^1<<31)<<16); err != nil {
+			return nil, err
+		}
+	}
+
+	neg.keys = append(neg.keys, pos.keys...)
+	neg.cs = append(neg.cs, pos.cs...)
+
+	return &neg, nil
+}
+
+// ReadBitmap32 reads a bitmap in the 32-bit roaring format.
+func ReadBitmap32(r io.Reader) (*Bitmap, error) {
+	b := &Bitmap{}
+	if err := (&bitmapReader{r: bufio.NewReader(r)}).bitmap32(b, 1<<47); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// bitmapReader reads serialized bitmaps.
+type bitmapReader struct {
+	r   *bufio.Reader
+	buf [8]byte
+	hi  uint32 // high 32 bits read last
+}
+
+// read reads len(b) bytes. The end of the input is ErrCorruptBitmap.
+func (br *bitmapReader) read(b []byte) error {
+	if _, err := io.ReadFull(br.r, b); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("%w: unexpected end", ErrCorruptBitmap)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (br *bitmapReader) uint16() (uint16, error) {
+	err := br.read(br.buf[:2])
+	return binary.LittleEndian.Uint16(br.buf[:]), err
+}
+
+func (br *bitmapReader) uint32() (uint32, error) {
+	err := br.read(br.buf[:4])
+	return binary.LittleEndian.Uint32(br.buf[:]), err
+}
+
+func (br *bitmapReader) uint64() (uint64, error) {
+	err := br.read(br.buf[:8])
+	return binary.LittleEndian.Uint64(br.buf[:]), err
+}
+
+// bitmap32 reads a 32-bit bitmap adding its containers to b. The keys of
+// the containers are added to base.
+func (br *bitmapReader) bitmap32(b *Bitmap, base uint64) error {
+	cookie, err := br.uint32()
+	if err != nil {
+		return err
+	}
+
+	var (
+		n     int
+		flags []byte // run container flags
+	)
+
+	switch {
+	case cookie&0xffff == serialCookie:
+		n = int(cookie>>16) + 1
+		flags = make([]byte, (n+7)/8)
+
+		if err = br.read(flags); err != nil {
+			return err
+		}
+	case cookie == serialCookieNoRuns:
+		size, err := br.uint32()
+		if err != nil {
+			return err
+		}
+
+		if size > 1<<16 {
+			return fmt.Errorf("%w: %d containers", ErrCorruptBitmap, size)
+		}
+
+		n = int(size)
+	default:
+		return fmt.Errorf("%w: unknown cookie %d", ErrCorruptBitmap, cookie)
+	}
+
+	header := make([]byte, 4*n)
+	if err = br.read(header); err != nil {
+		return err
+	}
+
+	if flags == nil || n >= noOffsetThreshold {
+		// offsets of the containers, not needed as they are read in order.
+		if err = br.read(make([]byte, 4*n)); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		key := binary.LittleEndian.Uint16(header[4*i:])
+		card := int(binary.LittleEndian.Uint16(header[4*i+2:])) + 1
+
+		if i > 0 && key <= binary.LittleEndian.Uint16(header[4*i-4:]) {
+			return fmt.Errorf("%w: container %d after %d", ErrCorruptBitmap, key, binary.LittleEndian.Uint16(header[4*i-4:]))
+		}
+
+		var c *container
+
+		switch {
+		case flags != nil && flags[i/8]&(1<<uint(i%8)) != 0:
+			c, err = br.runContainer()
+		case card <= maxArray:
+			c, err = br.arrayContainer(card)
+		default:
+			c, err = br.bitmapContainer()
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if c.n != card {
+			return fmt.Errorf("%w: container %d has %d values, want %d", ErrCorruptBitmap, key, c.n, card)
+		}
+
+		b.add(base+uint64(key), c)
+	}
+
+	return nil
+}
+
+func (br *bitmapReader) arrayContainer(n int) (*container, error) {
+	a := make([]uint16, n)
+
+	for i := range a {
+		x, err := br.uint16()
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 && x <= a[i-1] {
+			return nil, fmt.Errorf("%w: array value %d after %d", ErrCorruptBitmap, x, a[i-1])
+		}
+
+		a[i] = x
+	}
+
+	return &container{n: n, arr: a}, nil
+}
+
+func (br *bitmapReader) bitmapContainer() (*container, error) {
+	b := make([]uint64, bitmapWords)
+	n := 0
+
+	for i := range b {
+		w, err := br.uint64()
+		if err != nil {
+			return nil, err
+		}
+
+		b[i] = w
+		n += bits.OnesCount64(w)
+	}
+
+	return &container{n: n, bits: b}, nil
+}
+
+func (br *bitmapReader) runContainer() (*container, error) {
+	r, err := br.uint16()
+	if err != nil {
+		return nil, err
+	}
+
+	runs := make([]interval, r)
+	n := 0
+
+	for i := range runs {
+		start, err := br.uint16()
+		if err != nil {
+			return nil, err
+		}
+
+		length, err := br.uint16()
+		if err != nil {
+			return nil, err
+		}
+
+		if int(start)+int(length) >= 1<<16 || i > 0 && start <= runs[i-1].last {
+			return nil, fmt.Errorf("%w: run %d of %d values", ErrCorruptBitmap, start, int(length)+1)
+		}
+
+		runs[i] = interval{start, start + length}
+		n += int(length) + 1
+	}
+
+	return &container{n: n, runs: runs}, nil
+}
@@ -1,6 +1,7 @@
 package sets
 
 import (
+	"container/heap"
 	"math/rand"
 )
 
@@ -92,7 +93,7 @@ func unionInt64Sorted(a, b []int64) []int64 {
 
 	if i < len(a) {
 		a = a[i:]
-	} else if j < len(b) {
+	} else {
 		a = b[j:]
 	}
 
@@ -293,6 +294,159 @@ func diffInt64Sorted(a, b []int64) []int64 {
 	return res
 }
 
+// XorInt64 finds the symmetric difference of all the given sets:
+// the elements present in an odd number of sets.
+func XorInt64(args ...[]int64) []int64 {
+	return countInt64(args, func(count int) bool {
+		return count%2 == 1
+	})
+}
+
+// XorInt64Sorted finds the symmetric difference of all the given sets:
+// the elements present in an odd number of sets.
+// The slices must be sorted in ascending order.
+func XorInt64Sorted(args ...[]int64) []int64 {
+	return mergeInt64Sorted(args, func(count int) bool {
+		return count%2 == 1
+	})
+}
+
+// OneInt64 finds the elements present in exactly one of the given sets.
+func OneInt64(args ...[]int64) []int64 {
+	return countInt64(args, func(count int) bool {
+		return count == 1
+	})
+}
+
+// OneInt64Sorted finds the elements present in exactly one of the given sets.
+// The slices must be sorted in ascending order.
+func OneInt64Sorted(args ...[]int64) []int64 {
+	return mergeInt64Sorted(args, func(count int) bool {
+		return count == 1
+	})
+}
+
+// AtLeastInt64 finds the elements present in at least k of the given sets.
+func AtLeastInt64(k int, args ...[]int64) []int64 {
+	return countInt64(args, func(count int) bool {
+		return count >= k
+	})
+}
+
+// AtLeastInt64Sorted finds the elements present in at least k of the given sets.
+// The slices must be sorted in ascending order.
+func AtLeastInt64Sorted(k int, args ...[]int64) []int64 {
+	return mergeInt64Sorted(args, func(count int) bool {
+		return count >= k
+	})
+}
+
+// AtMostInt64 finds the elements present in at most k of the given sets.
+func AtMostInt64(k int, args ...[]int64) []int64 {
+	return countInt64(args, func(count int) bool {
+		return count <= k
+	})
+}
+
+// AtMostInt64Sorted finds the elements present in at most k of the given sets.
+// The slices must be sorted in ascending order.
+func AtMostInt64Sorted(k int, args ...[]int64) []int64 {
+	return mergeInt64Sorted(args, func(count int) bool {
+		return count <= k
+	})
+}
+
+// countInt64 counts occurrences of the elements of the sets
+// and returns the elements whose number is accepted by keep.
+func countInt64(args [][]int64, keep func(count int) bool) []int64 {
+	var n int
+	for i := range args {
+		n += len(args[i])
+	}
+
+	tmp := make(map[int64]int, n)
+
+	for i := range args {
+		for j := range args[i] {
+			tmp[args[i][j]]++
+		}
+	}
+
+	res := make([]int64, 0, len(tmp))
+
+	for k, v := range tmp {
+		if keep(v) {
+			res = append(res, k)
+		}
+	}
+
+	return res
+}
+
+// mergeInt64Sorted merges the sorted sets in a single pass
+// and returns the elements whose number of occurrences is accepted by keep.
+func mergeInt64Sorted(args [][]int64, keep func(count int) bool) []int64 {
+	var (
+		h   = make(sliceHeap, 0, len(args))
+		max int
+	)
+
+	for i := range args {
+		if len(args[i]) > 0 {
+			h = append(h, args[i])
+		}
+
+		if len(args[i]) > max {
+			max = len(args[i])
+		}
+	}
+
+	heap.Init(&h)
+
+	res := make([]int64, 0, max)
+
+	for len(h) > 0 {
+		v := h[0][0]
+
+		var count int
+		for len(h) > 0 && h[0][0] == v {
+			count++
+
+			if h[0] = h[0][1:]; len(h[0]) > 0 {
+				heap.Fix(&h, 0)
+			} else {
+				heap.Pop(&h)
+			}
+		}
+
+		if keep(count) {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// sliceHeap is a min-heap of non-empty sorted slices ordered by their first elements.
+type sliceHeap [][]int64
+
+func (h sliceHeap) Len() int           { return len(h) }
+func (h sliceHeap) Less(i, j int) bool { return h[i][0] < h[j][0] }
+func (h sliceHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *sliceHeap) Push(x interface{}) {
+	*h = append(*h, x.([]int64))
+}
+
+func (h *sliceHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+
+	return x
+}
+
 // TestData makes unordered sets from a to z with len (l) and random max values.
 func TestData(l, max int64) map[string][]int64 {
 	d := make(map[string][]int64, 'z'-'a'+1)
@@ -20,6 +20,10 @@ var ttUnion = []struct { //nolint: gochecknoglobals
 		{0, 1, 2, 3},
 		{4, 5},
 	}, []int64{0, 1, 2, 3, 4, 5}},
+	{[][]int64{
+		{3, 4, 7},
+		{3, 7},
+	}, []int64{3, 4, 7}},
 	{[][]int64{
 		{0, 1, 2, 3},
 		{2, 3, 4, 5},
@@ -290,3 +294,185 @@ func BenchmarkDiffInt64Sorted(b *testing.B) {
 
 	result = r
 }
+
+var ttXor = []struct { //nolint: gochecknoglobals
+	in  [][]int64
+	out []int64
+}{
+	{[][]int64{
+		{0, 1, 2, 3},
+	}, []int64{0, 1, 2, 3}},
+	{[][]int64{
+		{0, 1, 2, 3},
+		{2, 3, 4, 5},
+	}, []int64{0, 1, 4, 5}},
+	{[][]int64{
+		{0, 1, 2, 3},
+		{2, 3, 4, 5},
+		{3, 5, 7},
+	}, []int64{0, 1, 3, 4, 7}},
+	{[][]int64{
+		{1, 2},
+		{1, 2},
+	}, []int64{}},
+	{[][]int64{
+		{},
+		nil,
+	}, []int64{}},
+}
+
+func TestXorInt64(t *testing.T) {
+	var out []int64
+	for i, tt := range ttXor {
+		out = sortutil.SortInt64(sets.XorInt64(tt.in...))
+		if !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+	}
+}
+
+func TestXorInt64Sorted(t *testing.T) {
+	var out []int64
+	for i, tt := range ttXor {
+		out = sets.XorInt64Sorted(tt.in...)
+		if !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+	}
+}
+
+var ttOne = []struct { //nolint: gochecknoglobals
+	in  [][]int64
+	out []int64
+}{
+	{[][]int64{
+		{0, 1, 2, 3},
+	}, []int64{0, 1, 2, 3}},
+	{[][]int64{
+		{0, 1, 2, 3},
+		{2, 3, 4, 5},
+	}, []int64{0, 1, 4, 5}},
+	{[][]int64{
+		{0, 1, 2, 3},
+		{2, 3, 4, 5},
+		{3, 5, 7},
+	}, []int64{0, 1, 4, 7}},
+	{[][]int64{
+		{7},
+		{2, 3},
+		{2, 3, 4},
+	}, []int64{4, 7}},
+	{[][]int64{
+		{},
+		nil,
+	}, []int64{}},
+}
+
+func TestOneInt64(t *testing.T) {
+	var out []int64
+	for i, tt := range ttOne {
+		out = sortutil.SortInt64(sets.OneInt64(tt.in...))
+		if !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+	}
+}
+
+func TestOneInt64Sorted(t *testing.T) {
+	var out []int64
+	for i, tt := range ttOne {
+		out = sets.OneInt64Sorted(tt.in...)
+		if !reflect.DeepEqual(out, tt.out) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.out)
+		}
+	}
+}
+
+func BenchmarkXorInt64Sorted(b *testing.B) {
+	var r []int64
+	for n := 0; n < b.N; n++ {
+		r = sets.XorInt64Sorted(
+			data["a"], data["b"], data["c"], data["d"], data["e"], data["f"])
+	}
+
+	result = r
+}
+
+var ttThreshold = []struct { //nolint: gochecknoglobals
+	k     int
+	in    [][]int64
+	least []int64
+	most  []int64
+}{
+	{1, [][]int64{
+		{0, 1, 2, 3},
+	}, []int64{0, 1, 2, 3}, []int64{0, 1, 2, 3}},
+	{2, [][]int64{
+		{0, 1, 2, 3},
+		{2, 3, 4, 5},
+		{3, 5, 7},
+	}, []int64{2, 3, 5}, []int64{0, 1, 2, 4, 5, 7}},
+	{3, [][]int64{
+		{0, 1, 2, 3},
+		{2, 3, 4, 5},
+		{3, 5, 7},
+	}, []int64{3}, []int64{0, 1, 2, 3, 4, 5, 7}},
+	{0, [][]int64{
+		{1, 2},
+		{2, 3},
+	}, []int64{1, 2, 3}, []int64{}},
+	{4, [][]int64{
+		{1, 2},
+		{2, 3},
+	}, []int64{}, []int64{1, 2, 3}},
+}
+
+func TestAtLeastInt64(t *testing.T) {
+	var out []int64
+	for i, tt := range ttThreshold {
+		out = sortutil.SortInt64(sets.AtLeastInt64(tt.k, tt.in...))
+		if !reflect.DeepEqual(out, tt.least) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.least)
+		}
+	}
+}
+
+func TestAtLeastInt64Sorted(t *testing.T) {
+	var out []int64
+	for i, tt := range ttThreshold {
+		out = sets.AtLeastInt64Sorted(tt.k, tt.in...)
+		if !reflect.DeepEqual(out, tt.least) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.least)
+		}
+	}
+}
+
+func TestAtMostInt64(t *testing.T) {
+	var out []int64
+	for i, tt := range ttThreshold {
+		out = sortutil.SortInt64(sets.AtMostInt64(tt.k, tt.in...))
+		if !reflect.DeepEqual(out, tt.most) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.most)
+		}
+	}
+}
+
+func TestAtMostInt64Sorted(t *testing.T) {
+	var out []int64
+	for i, tt := range ttThreshold {
+		out = sets.AtMostInt64Sorted(tt.k, tt.in...)
+		if !reflect.DeepEqual(out, tt.most) {
+			t.Errorf("pos %v: got %v, want %v", i, out, tt.most)
+		}
+	}
+}
+
+func BenchmarkAtLeastInt64Sorted(b *testing.B) {
+	var r []int64
+	for n := 0; n < b.N; n++ {
+		r = sets.AtLeastInt64Sorted(3,
+			data["a"], data["b"], data["c"], data["d"], data["e"], data["f"])
+	}
+
+	result = r
+}
@@ -13,6 +13,10 @@ func SortInt64(v []int64) []int64 {
 // DeDupInt64 deduplicates slice of int64 values.
 // The slices must be sorted in ascending order.
 func DeDupInt64(v []int64) []int64 {
+	if len(v) == 0 {
+		return v
+	}
+
 	var j int
 
 	for i := 1; i < len(v); i++ {
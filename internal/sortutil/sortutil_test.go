@@ -34,6 +34,7 @@ func TestDeDupInt64(t *testing.T) {
 			out []int64
 		}{
 			{[]int64{1, 1, 1, 2, 2, 3, 3, 4, 4}, []int64{1, 2, 3, 4}},
+			{[]int64{}, []int64{}},
 		}
 
 		out []int64
@@ -0,0 +1,20 @@
+// Package testutil holds helpers shared by the tests of the packages.
+package testutil
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// TempDir makes a temporary directory removed by cleanup.
+func TempDir(t *testing.T) (dir string, cleanup func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "sc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, func() { os.RemoveAll(dir) }
+}